@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,23 +12,29 @@ import (
 	"github.com/go-mixins/log"
 	"github.com/go-mixins/microservice/config"
 	mw "github.com/go-mixins/microservice/http"
+	"github.com/go-mixins/microservice/idempotency"
+	"github.com/go-mixins/microservice/redact"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/trace"
+	"google.golang.org/grpc"
 )
 
 // App binds various parts together
 type App struct {
-	Config          *config.Config
-	Logger          log.ContextLogger
-	Handler         http.Handler
-	MetricsExporter view.Exporter
-	TraceExporter   trace.Exporter
-	wg              sync.WaitGroup
-	stopChan        chan struct{}
-	metricsHandler  http.Handler
-	readinessChecks []mw.Checker
-	flushers        []interface{ Flush() }
-	once            sync.Once
+	Config           *config.Config
+	Logger           log.ContextLogger
+	Handler          http.Handler
+	MetricsExporter  view.Exporter
+	TraceExporter    trace.Exporter
+	wg               sync.WaitGroup
+	stopChan         chan struct{}
+	metricsHandler   http.Handler
+	grpcServer       *grpc.Server
+	idempotency      idempotency.Store
+	idempotencyScope idempotency.Scope
+	readinessChecks  []mw.Checker
+	flushers         []interface{ Flush() }
+	once             sync.Once
 }
 
 // FlushLogs pending hooks
@@ -51,6 +58,9 @@ func (app *App) Run() error {
 	if err := app.connectMetrics(); err != nil {
 		app.Logger.Warnf("metrics export is not available: %v", err)
 	}
+	if err := config.Load(&redact.Default); err != nil {
+		return err
+	}
 	if connector, ok := app.Handler.(interface{ Connect() error }); ok {
 		if err := connector.Connect(); err != nil {
 			return err
@@ -59,14 +69,17 @@ func (app *App) Run() error {
 	if closer, ok := app.Handler.(interface{ Close() error }); ok {
 		defer closer.Close()
 	}
-	httpErrors, err := app.connectHTTP()
-	if err != nil {
+	if err := app.connectIdempotency(); err != nil {
 		return err
 	}
 	grpcErrors, err := app.connectGRPC()
 	if err != nil {
 		return err
 	}
+	httpErrors, err := app.connectHTTP()
+	if err != nil {
+		return err
+	}
 	app.Logger.Debugf("running in Timezone %v", time.Local)
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, os.Kill, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGKILL)
@@ -88,6 +101,30 @@ func (app *App) Run() error {
 	return err
 }
 
+// connectIdempotency enables idempotency keys of gRPC calls if the handler
+// provides a store or the in-memory one is enabled in config. HTTP handlers
+// install mw.WithIdempotency after their authentication themselves.
+func (app *App) connectIdempotency() error {
+	if provider, ok := app.Handler.(interface{ IdempotencyScope(context.Context) string }); ok {
+		app.idempotencyScope = provider.IdempotencyScope
+	}
+	if provider, ok := app.Handler.(interface{ IdempotencyStore() idempotency.Store }); ok {
+		app.idempotency = provider.IdempotencyStore()
+	} else {
+		var cfg idempotency.Config
+		if err := config.Load(&cfg); err != nil {
+			return err
+		}
+		if cfg.Enabled {
+			app.idempotency = idempotency.NewMemoryStore(cfg)
+		}
+	}
+	if app.idempotency != nil && app.idempotencyScope == nil {
+		app.Logger.Warnf("idempotency keys are shared by all callers: handler has no IdempotencyScope method")
+	}
+	return nil
+}
+
 func (app *App) Stop() error {
 	close(app.stopChan)
 	app.wg.Wait()
@@ -7,6 +7,7 @@ import (
 	"github.com/go-mixins/log"
 	"google.golang.org/grpc"
 
+	"github.com/go-mixins/microservice/config"
 	gRPCmw "github.com/go-mixins/microservice/grpc"
 )
 
@@ -22,11 +23,21 @@ func (app *App) connectGRPC() (<-chan error, error) {
 	}); ok {
 		mw = append(mw, optsProvider.GRPCInterceptors()...)
 	}
+	if gRPCmw.IdempotencyStore == nil {
+		gRPCmw.IdempotencyStore = app.idempotency
+	}
+	if gRPCmw.IdempotencyScope == nil {
+		gRPCmw.IdempotencyScope = app.idempotencyScope
+	}
+	if err := config.Load(&gRPCmw.Timeouts); err != nil {
+		return nil, err
+	}
 	opts := gRPCmw.ServerMiddleware(app.Logger.WithContext(log.M{"logger": "gRPC"}), mw...)
 	grpcServer := grpc.NewServer(opts...)
 	if err := grpcConnector.ConnectGRPC(grpcServer); err != nil {
 		return nil, err
 	}
+	app.grpcServer = grpcServer
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", app.Config.GRPCPort))
 	if err != nil {
 		return nil, fmt.Errorf("opening listener: %w", err)
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/go-mixins/log"
+	"github.com/go-mixins/microservice/config"
 
 	mw "github.com/go-mixins/microservice/http"
 )
@@ -20,14 +21,61 @@ func (app *App) stopTimeout() time.Duration {
 
 func (app *App) connectHTTP() (<-chan error, error) {
 	errorChan := make(chan error, 1)
+	mw.PrettyJSON = app.Config.PrettyJSON
+	resolver := mw.DefaultRouteResolver
+	if r, ok := app.Handler.(mw.RouteResolver); ok {
+		resolver = r
+	}
+	// middleware outside of WithPrefix sees requests with the prefix
+	routes := mw.PrefixRouteResolver(resolver, app.Config.HTTPPrefix)
 	handler := mw.WithHealth(app.Handler, app.readinessChecks...)
 	handler = mw.WithMetrics(handler, app.metricsHandler)
-	handler = mw.WithLog(handler, app.Logger.WithContext(log.M{"logger": "http"}))
+	if app.Config.GRPCWeb && app.grpcServer != nil {
+		handler = mw.WithGRPCWeb(handler, app.grpcServer)
+	}
+	if app.Config.HTTPPrefix != "" {
+		root := mw.WithMetrics(mw.WithHealth(nil, app.readinessChecks...), app.metricsHandler)
+		handler = mw.WithPrefix(handler, app.Config.HTTPPrefix, root)
+	}
+	cacheOpts := []mw.CacheOption{mw.CacheRoutes(routes)}
+	if provider, ok := app.Handler.(interface{ CacheOptions() []mw.CacheOption }); ok {
+		cacheOpts = append(cacheOpts, provider.CacheOptions()...)
+	}
+	handler = mw.WithCache(handler, cacheOpts...)
+	var compressConfig mw.CompressConfig
+	if err := config.Load(&compressConfig); err != nil {
+		return nil, err
+	}
+	handler = mw.WithCompression(handler, compressConfig)
+	var corsConfig mw.CORSConfig
+	if err := config.Load(&corsConfig); err != nil {
+		return nil, err
+	}
+	if len(corsConfig.AllowedOrigins) > 0 {
+		handler = mw.WithCORS(handler, corsConfig)
+	}
+	var timeoutConfig mw.TimeoutConfig
+	if err := config.Load(&timeoutConfig); err != nil {
+		return nil, err
+	}
+	logOpts := []mw.LogOption{mw.LogPrefix(app.Config.HTTPPrefix)}
+	if resolver != mw.DefaultRouteResolver {
+		logOpts = append(logOpts, mw.LogRoutes(routes))
+	}
+	handler = mw.WithTimeout(handler, timeoutConfig, routes)
+	handler = mw.WithLog(handler, app.Logger.WithContext(log.M{"logger": "http"}), logOpts...)
+	var proxyConfig mw.ProxyConfig
+	if err := config.Load(&proxyConfig); err != nil {
+		return nil, err
+	}
+	handler = mw.WithClientIP(handler, proxyConfig.TrustedProxies)
+	handler = mw.WithRequestID(handler)
 	handler = mw.WithTracing(handler)
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", app.Config.HTTPPort),
 		Handler: handler,
 	}
+	server.RegisterOnShutdown(func() { mw.CloseWebSockets(server) })
 	app.wg.Add(1)
 	go func() {
 		defer app.wg.Done()
@@ -2,16 +2,25 @@ package prom
 
 import (
 	"fmt"
+	"runtime"
 	"strings"
 
 	"github.com/go-mixins/microservice/config"
 
 	"contrib.go.opencensus.io/exporter/prometheus"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 func New(cfg *config.Config) (*prometheus.Exporter, error) {
+	namespace := strings.Replace(cfg.ServiceName, "-", "_", -1)
+	registry := prom.NewRegistry()
+	if err := registerCollectors(registry, namespace, cfg); err != nil {
+		return nil, err
+	}
 	pe, err := prometheus.NewExporter(prometheus.Options{
-		Namespace: strings.Replace(cfg.ServiceName, "-", "_", -1),
+		Namespace: namespace,
+		Registry:  registry,
 		ConstLabels: map[string]string{
 			"environment": cfg.Environment,
 		},
@@ -21,3 +30,29 @@ func New(cfg *config.Config) (*prometheus.Exporter, error) {
 	}
 	return pe, nil
 }
+
+// registerCollectors adds Go runtime, process and build info metrics
+func registerCollectors(registry *prom.Registry, namespace string, cfg *config.Config) error {
+	buildInfo := prom.NewGauge(prom.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "A metric with a constant '1' value labeled by service name, environment and version.",
+		ConstLabels: prom.Labels{
+			"service_name": cfg.ServiceName,
+			"environment":  cfg.Environment,
+			"version":      cfg.Version,
+			"goversion":    runtime.Version(),
+		},
+	})
+	buildInfo.Set(1)
+	for _, c := range []prom.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		buildInfo,
+	} {
+		if err := registry.Register(c); err != nil {
+			return fmt.Errorf("register prometheus collector: %+v", err)
+		}
+	}
+	return nil
+}
@@ -11,9 +11,12 @@ import (
 type Config struct {
 	Environment string        `envconfig:"ENVIRONMENT" default:"master"`
 	ServiceName string        `envconfig:"SERVICE_NAME" required:"true"`
+	Version     string        `envconfig:"VERSION" default:"unknown"`
 	HTTPPort    int           `envconfig:"HTTP_PORT" default:"5000"`
 	HTTPPrefix  string        `envconfig:"HTTP_PREFIX"`
+	PrettyJSON  bool          `envconfig:"HTTP_PRETTY_JSON"`
 	GRPCPort    int           `envconfig:"GRPC_PORT" default:"8080"`
+	GRPCWeb     bool          `envconfig:"GRPC_WEB"`
 	Debug       bool          `envconfig:"DEBUG" default:"true"`
 	SentryDSN   string        `envconfig:"SENTRY_DSN"`
 	GraylogURI  string        `envconfig:"GRAYLOG_URI"`
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Timeouts maps route or method patterns to durations. It is decoded from
+// comma separated "pattern=duration" pairs, so patterns may contain colons,
+// e.g. "GET /users/:id=2s,/pkg.Service/*=10s".
+type Timeouts map[string]time.Duration
+
+// Decode implements envconfig.Decoder
+func (t *Timeouts) Decode(value string) error {
+	res := make(Timeouts)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		i := strings.LastIndexByte(pair, '=')
+		if i < 0 {
+			return fmt.Errorf("invalid timeout %q: expected pattern=duration", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(pair[i+1:]))
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q: %w", pair, err)
+		}
+		res[strings.TrimSpace(pair[:i])] = d
+	}
+	*t = res
+	return nil
+}
+
+// Lookup returns duration of the first pattern found among keys
+func (t Timeouts) Lookup(keys ...string) (time.Duration, bool) {
+	for _, k := range keys {
+		if d, ok := t[k]; ok {
+			return d, true
+		}
+	}
+	return 0, false
+}
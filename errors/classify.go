@@ -0,0 +1,71 @@
+package errors
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Classifier converts errors without gRPC status to one. It returns nil for
+// unrecognized errors.
+type Classifier func(err error) *status.Status
+
+var registry = struct {
+	sync.RWMutex
+	classifiers []Classifier
+}{
+	classifiers: []Classifier{
+		Sentinel(context.DeadlineExceeded, codes.DeadlineExceeded),
+		Sentinel(context.Canceled, codes.Canceled),
+		Sentinel(os.ErrDeadlineExceeded, codes.DeadlineExceeded),
+		Sentinel(sql.ErrNoRows, codes.NotFound),
+		Sentinel(os.ErrNotExist, codes.NotFound),
+		Sentinel(os.ErrExist, codes.AlreadyExists),
+		Sentinel(os.ErrPermission, codes.PermissionDenied),
+	},
+}
+
+// Sentinel creates Classifier that maps errors matching target with
+// errors.Is to the code. The target's text is used as status message so
+// that details of wrapping errors are not exposed to clients.
+func Sentinel(target error, c codes.Code) Classifier {
+	return func(err error) *status.Status {
+		if errors.Is(err, target) {
+			return status.New(c, target.Error())
+		}
+		return nil
+	}
+}
+
+// RegisterClassifier adds classifier to the registry. Classifiers registered
+// later take precedence over earlier ones and the standard ones.
+func RegisterClassifier(c Classifier) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.classifiers = append(registry.classifiers, c)
+}
+
+// RegisterSentinel maps errors matching target with errors.Is to the code
+func RegisterSentinel(target error, c codes.Code) {
+	RegisterClassifier(Sentinel(target, c))
+}
+
+// Classify runs registered classifiers against every error in the chain.
+// The second result is false if the error is not recognized.
+func Classify(err error) (*status.Status, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for ; err != nil; err = next(err) {
+		for i := len(registry.classifiers) - 1; i >= 0; i-- {
+			if st := registry.classifiers[i](err); st != nil {
+				return st, true
+			}
+		}
+	}
+	return nil, false
+}
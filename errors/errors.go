@@ -0,0 +1,290 @@
+// Package errors provides constructors of errors carrying gRPC status with
+// google.rpc error details. The errors wrap their causes, work with standard
+// errors.Is and errors.As and are rendered the same way by gRPC server and
+// HTTP error responses.
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/runtime/protoimpl"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Error has gRPC code, client-facing message, details and optional cause
+type Error struct {
+	code       codes.Code
+	message    string
+	details    []proto.Message
+	cause      error
+	httpStatus int
+}
+
+// New creates an error with the code and message
+func New(c codes.Code, message string, details ...proto.Message) *Error {
+	return &Error{code: c, message: message, details: details}
+}
+
+// Errorf creates an error with the code and formatted message
+func Errorf(c codes.Code, format string, args ...interface{}) *Error {
+	return New(c, fmt.Sprintf(format, args...))
+}
+
+// Error implements error. The cause is included in the result but is not
+// exposed to clients.
+func (e *Error) Error() string {
+	res := e.message
+	if res == "" {
+		res = e.code.String()
+	}
+	if e.cause != nil {
+		res += ": " + e.cause.Error()
+	}
+	return res
+}
+
+// Code returns gRPC code of the error
+func (e *Error) Code() codes.Code {
+	return e.code
+}
+
+// Unwrap returns the cause
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is matches errors with the same code. If target has a message, it must be
+// equal as well.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return t.code == e.code && (t.message == "" || t.message == e.message)
+}
+
+// GRPCStatus converts the error to gRPC status with details
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(e.code, e.message)
+	if len(e.details) == 0 {
+		return st
+	}
+	details := make([]protoiface.MessageV1, len(e.details))
+	for i, d := range e.details {
+		details[i] = protoimpl.X.ProtoMessageV1Of(d)
+	}
+	res, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+	return res
+}
+
+// Wrap returns a copy of the error with the cause
+func (e *Error) Wrap(cause error) *Error {
+	res := *e
+	res.cause = cause
+	return &res
+}
+
+// WithDetails returns a copy of the error with details appended
+func (e *Error) WithDetails(details ...proto.Message) *Error {
+	res := *e
+	res.details = append(append([]proto.Message(nil), e.details...), details...)
+	return &res
+}
+
+// Details returns error details
+func (e *Error) Details() []proto.Message {
+	return e.details
+}
+
+// WithHTTPStatus returns a copy of the error rendered with the HTTP status
+// instead of one mapped from its code
+func (e *Error) WithHTTPStatus(status int) *Error {
+	res := *e
+	res.httpStatus = status
+	return &res
+}
+
+// HTTPStatus returns HTTP status set by WithHTTPStatus or zero
+func (e *Error) HTTPStatus() int {
+	return e.httpStatus
+}
+
+// Sentinel errors for matching with errors.Is by code
+var (
+	ErrCanceled           = New(codes.Canceled, "")
+	ErrUnknown            = New(codes.Unknown, "")
+	ErrInvalidArgument    = New(codes.InvalidArgument, "")
+	ErrDeadlineExceeded   = New(codes.DeadlineExceeded, "")
+	ErrNotFound           = New(codes.NotFound, "")
+	ErrAlreadyExists      = New(codes.AlreadyExists, "")
+	ErrPermissionDenied   = New(codes.PermissionDenied, "")
+	ErrResourceExhausted  = New(codes.ResourceExhausted, "")
+	ErrFailedPrecondition = New(codes.FailedPrecondition, "")
+	ErrAborted            = New(codes.Aborted, "")
+	ErrOutOfRange         = New(codes.OutOfRange, "")
+	ErrUnimplemented      = New(codes.Unimplemented, "")
+	ErrInternal           = New(codes.Internal, "")
+	ErrUnavailable        = New(codes.Unavailable, "")
+	ErrDataLoss           = New(codes.DataLoss, "")
+	ErrUnauthenticated    = New(codes.Unauthenticated, "")
+)
+
+// Field describes invalid request field
+func Field(field, description string) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{Field: field, Description: description}
+}
+
+// Precondition describes failed precondition
+func Precondition(typ, subject, description string) *errdetails.PreconditionFailure_Violation {
+	return &errdetails.PreconditionFailure_Violation{Type: typ, Subject: subject, Description: description}
+}
+
+// InvalidArgument creates an error with BadRequest details
+func InvalidArgument(message string, violations ...*errdetails.BadRequest_FieldViolation) *Error {
+	res := New(codes.InvalidArgument, message)
+	if len(violations) > 0 {
+		res.details = append(res.details, &errdetails.BadRequest{FieldViolations: violations})
+	}
+	return res
+}
+
+// NotFound creates an error with ResourceInfo details
+func NotFound(resourceType, resourceName string) *Error {
+	return New(codes.NotFound, fmt.Sprintf("%s %q not found", resourceType, resourceName), &errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: resourceName,
+	})
+}
+
+// AlreadyExists creates an error with ResourceInfo details
+func AlreadyExists(resourceType, resourceName string) *Error {
+	return New(codes.AlreadyExists, fmt.Sprintf("%s %q already exists", resourceType, resourceName), &errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: resourceName,
+	})
+}
+
+// FailedPrecondition creates an error with PreconditionFailure details
+func FailedPrecondition(message string, violations ...*errdetails.PreconditionFailure_Violation) *Error {
+	res := New(codes.FailedPrecondition, message)
+	if len(violations) > 0 {
+		res.details = append(res.details, &errdetails.PreconditionFailure{Violations: violations})
+	}
+	return res
+}
+
+// Unavailable creates an error with RetryInfo details if retryAfter is
+// positive
+func Unavailable(message string, retryAfter time.Duration) *Error {
+	res := New(codes.Unavailable, message)
+	if retryAfter > 0 {
+		res.details = append(res.details, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	}
+	return res
+}
+
+// ResourceExhausted creates an error with RetryInfo details if retryAfter is
+// positive
+func ResourceExhausted(message string, retryAfter time.Duration) *Error {
+	res := New(codes.ResourceExhausted, message)
+	if retryAfter > 0 {
+		res.details = append(res.details, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	}
+	return res
+}
+
+// PermissionDenied creates an error with the message
+func PermissionDenied(message string) *Error {
+	return New(codes.PermissionDenied, message)
+}
+
+// Unauthenticated creates an error with the message
+func Unauthenticated(message string) *Error {
+	return New(codes.Unauthenticated, message)
+}
+
+// Aborted creates an error with the message
+func Aborted(message string) *Error {
+	return New(codes.Aborted, message)
+}
+
+// Internal wraps the cause into an error with generic message
+func Internal(cause error) *Error {
+	return New(codes.Internal, "internal error").Wrap(cause)
+}
+
+// Status finds gRPC status in the error chain following both Unwrap and
+// Cause methods. Errors without status are passed to registered classifiers.
+// The second result is false if the error is not recognized.
+func Status(err error) (*status.Status, bool) {
+	for e := err; e != nil; e = next(e) {
+		if x, ok := e.(interface{ GRPCStatus() *status.Status }); ok {
+			return x.GRPCStatus(), true
+		}
+	}
+	return Classify(err)
+}
+
+func next(err error) error {
+	switch x := err.(type) {
+	case interface{ Unwrap() error }:
+		return x.Unwrap()
+	case interface{ Cause() error }:
+		return x.Cause()
+	}
+	return nil
+}
+
+// Detailed reports whether err carries more information than its status,
+// e.g. has a cause or was classified from a standard error
+func Detailed(err error, st *status.Status) bool {
+	text := err.Error()
+	return text != st.Message() && text != st.Err().Error()
+}
+
+// Code returns gRPC code of the error, codes.OK for nil and codes.Unknown
+// for errors without status
+func Code(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if st, ok := Status(err); ok {
+		return st.Code()
+	}
+	return codes.Unknown
+}
+
+// RetryAfter returns the delay from RetryInfo details of the status
+func RetryAfter(st *status.Status) (time.Duration, bool) {
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok && ri.GetRetryDelay() != nil {
+			return ri.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+// Is is errors.Is from standard library
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+// As is errors.As from standard library
+func As(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
+
+// Unwrap is errors.Unwrap from standard library
+func Unwrap(err error) error {
+	return errors.Unwrap(err)
+}
@@ -2,6 +2,7 @@ package grpc
 
 import (
 	mdGRPC "github.com/go-mixins/metadata/grpc"
+	"github.com/go-mixins/microservice/json"
 	"go.opencensus.io/plugin/ocgrpc"
 	"google.golang.org/grpc"
 )
@@ -14,6 +15,9 @@ func ClientMiddleware(extraMW ...grpc.UnaryClientInterceptor) []grpc.DialOption
 			mdGRPC.UnaryClientInterceptor(),
 		),
 	}
+	if JSONCodec != nil {
+		res = append(res, grpc.WithDefaultCallOptions(grpc.ForceCodec(json.GRPCCodec{Codec: JSONCodec})))
+	}
 	for _, e := range extraMW {
 		res = append(res, grpc.WithUnaryInterceptor(e))
 	}
@@ -0,0 +1,184 @@
+package grpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"github.com/go-mixins/log"
+	"github.com/go-mixins/metadata"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcMetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/runtime/protoimpl"
+
+	"github.com/go-mixins/microservice/errors"
+	"github.com/go-mixins/microservice/idempotency"
+)
+
+// IdempotencyStore, если задан, используется ServerMiddleware для обработки
+// вызовов с ключом идемпотентности
+var IdempotencyStore idempotency.Store
+
+// IdempotencyScope привязывает ключи идемпотентности ServerMiddleware к
+// вызывающему
+var IdempotencyScope idempotency.Scope
+
+// retryable codes are not stored so that the client could retry the call
+var retryable = map[codes.Code]bool{
+	codes.Canceled:          true,
+	codes.Unknown:           true,
+	codes.DeadlineExceeded:  true,
+	codes.ResourceExhausted: true,
+	codes.Aborted:           true,
+	codes.Internal:          true,
+	codes.Unavailable:       true,
+}
+
+// Idempotency возвращает сохранённый результат вызова с тем же ключом
+// идемпотентности из метаданных gRPC. Ключ не передаётся в исходящие вызовы
+// через метаданные контекста. Ключи привязаны к вызывающему через scope,
+// поэтому перехватчик устанавливается после аутентификации. Если scope не
+// задан, ключи общие для всех клиентов. Параллельные вызовы с одним ключом
+// отклоняются с кодом Aborted, повторное использование ключа с другим
+// запросом - с кодом FailedPrecondition.
+func Idempotency(store idempotency.Store, scope idempotency.Scope) grpc.UnaryServerInterceptor {
+	header := strings.ToLower(idempotency.Header)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		// the key belongs to this call only, so it is taken from the caller
+		// metadata and never propagated to outbound calls
+		if metadata.Get(ctx, idempotency.Header) != "" {
+			ctx = metadata.Del(ctx, idempotency.Header)
+		}
+		var key string
+		if md, ok := grpcMetadata.FromIncomingContext(ctx); ok {
+			if vv := md.Get(header); len(vv) > 0 {
+				key = vv[0]
+			}
+		}
+		if key == "" {
+			return handler(ctx, req)
+		}
+		if !idempotency.ValidKey(key) {
+			return nil, idempotency.ErrInvalidKey
+		}
+		var caller string
+		if scope != nil {
+			if caller = scope(ctx); caller == "" {
+				return handler(ctx, req)
+			}
+		}
+		hash, err := requestHash(req)
+		if err != nil {
+			return nil, err
+		}
+		key = strings.Join([]string{caller, info.FullMethod, key}, "\n")
+		stored, err := store.Begin(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if stored != nil {
+			if stored.RequestHash != hash {
+				return nil, idempotency.ErrKeyReused
+			}
+			_ = grpc.SetHeader(ctx, grpcMetadata.Pairs(strings.ToLower(idempotency.ReplayedHeader), "true"))
+			return replay(info.FullMethod, stored)
+		}
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := store.Release(ctx, key); err != nil {
+				log.Get(ctx).Warnf("releasing idempotency key: %+v", err)
+			}
+		}()
+		res, rErr := handler(ctx, req)
+		stored = &idempotency.Response{RequestHash: hash}
+		if rErr != nil {
+			st, _ := errors.Status(rErr)
+			if st == nil || retryable[st.Code()] {
+				return res, rErr
+			}
+			stored.Status = int(st.Code())
+			stored.Body, err = proto.Marshal(st.Proto())
+		} else {
+			switch msg := res.(type) {
+			case proto.Message:
+				stored.Body, err = proto.Marshal(msg)
+			case protoiface.MessageV1:
+				stored.Body, err = proto.Marshal(protoimpl.X.ProtoMessageV2Of(msg))
+			default:
+				return res, rErr
+			}
+		}
+		if err == nil && len(stored.Body) > idempotency.MaxResponseSize {
+			return res, rErr
+		}
+		if err == nil {
+			err = store.Complete(ctx, key, stored)
+		}
+		if err != nil {
+			log.Get(ctx).Warnf("storing idempotent response: %+v", err)
+			return res, rErr
+		}
+		completed = true
+		return res, rErr
+	}
+}
+
+// requestHash identifies request message by its deterministic serialization
+func requestHash(req interface{}) (string, error) {
+	var msg proto.Message
+	switch x := req.(type) {
+	case proto.Message:
+		msg = x
+	case protoiface.MessageV1:
+		msg = protoimpl.X.ProtoMessageV2Of(x)
+	default:
+		return "", errors.Errorf(codes.Internal, "%T is not a proto message", req)
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", errors.Internal(err)
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// replay restores stored response. The response type is looked up by the
+// method descriptor in the global registry.
+func replay(fullMethod string, stored *idempotency.Response) (interface{}, error) {
+	if codes.Code(stored.Status) != codes.OK {
+		st := new(spb.Status)
+		if err := proto.Unmarshal(stored.Body, st); err != nil {
+			return nil, errors.Internal(err)
+		}
+		return nil, status.ErrorProto(st)
+	}
+	name := protoreflect.FullName(strings.ReplaceAll(strings.TrimPrefix(fullMethod, "/"), "/", "."))
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		return nil, errors.Internal(err)
+	}
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, errors.Errorf(codes.Internal, "%s is not a method", name)
+	}
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(method.Output().FullName())
+	if err != nil {
+		return nil, errors.Internal(err)
+	}
+	res := mt.New().Interface()
+	if err := proto.Unmarshal(stored.Body, res); err != nil {
+		return nil, errors.Internal(err)
+	}
+	return res, nil
+}
@@ -0,0 +1,68 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-mixins/metadata"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	grpcMetadata "google.golang.org/grpc/metadata"
+
+	"github.com/go-mixins/microservice/errors"
+	"github.com/go-mixins/microservice/idempotency"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		incoming []string
+		meta     string
+		calls    int
+		code     codes.Code
+	}{
+		{"raw metadata", []string{"idempotency-key", "k1"}, "", 1, codes.OK},
+		{"propagated metadata", nil, "k1", 2, codes.OK},
+		{"propagated and raw", []string{"idempotency-key", "k2"}, "k1", 1, codes.OK},
+		{"reused key", []string{"idempotency-key", "k1"}, "", 1, codes.FailedPrecondition},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := idempotency.NewMemoryStore(idempotency.Config{Size: 10, TTL: time.Hour})
+			calls := 0
+			intercept := Idempotency(store, nil)
+			info := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				calls++
+				if v := metadata.Get(ctx, idempotency.Header); v != "" {
+					t.Errorf("key %q is left in context metadata", v)
+				}
+				return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+			}
+			for i := 0; i < 2; i++ {
+				req := &healthpb.HealthCheckRequest{Service: "a"}
+				if tc.code != codes.OK && i == 1 {
+					req.Service = "b"
+				}
+				ctx := context.Background()
+				if tc.incoming != nil {
+					ctx = grpcMetadata.NewIncomingContext(ctx, grpcMetadata.Pairs(tc.incoming...))
+				}
+				if tc.meta != "" {
+					ctx = metadata.Set(ctx, idempotency.Header, tc.meta)
+				}
+				res, err := intercept(ctx, req, info, handler)
+				if code := errors.Code(err); i == 1 && code != tc.code {
+					t.Errorf("expected %v, got %v", tc.code, code)
+				}
+				if err == nil && res.(*healthpb.HealthCheckResponse).GetStatus() != healthpb.HealthCheckResponse_SERVING {
+					t.Errorf("unexpected response %v", res)
+				}
+			}
+			if calls != tc.calls {
+				t.Errorf("expected %d handler calls, got %d", tc.calls, calls)
+			}
+		})
+	}
+}
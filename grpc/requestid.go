@@ -0,0 +1,32 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/go-mixins/microservice/requestid"
+)
+
+// RequestID принимает идентификатор запроса из метаданных вызова или создает
+// новый. Идентификатор сохраняется в метаданных контекста и возвращается
+// клиенту в заголовках и трейлерах ответа.
+func RequestID() grpc.UnaryServerInterceptor {
+	key := strings.ToLower(requestid.Header)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var incoming string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if vv := md.Get(key); len(vv) > 0 {
+				incoming = vv[0]
+			}
+		}
+		id := requestid.Ensure(requestid.From(ctx), incoming)
+		ctx = requestid.With(ctx, id)
+		md := metadata.Pairs(key, id)
+		_ = grpc.SetHeader(ctx, md)
+		_ = grpc.SetTrailer(ctx, md)
+		return handler(ctx, req)
+	}
+}
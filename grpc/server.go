@@ -3,14 +3,16 @@ package grpc
 import (
 	"context"
 	"runtime/debug"
-	"sync"
 	"time"
 
 	"github.com/go-mixins/log"
 	mdGRPC "github.com/go-mixins/metadata/grpc"
+	"github.com/go-mixins/microservice/errors"
 	"github.com/go-mixins/microservice/json"
+	"github.com/go-mixins/microservice/metrics"
+	"github.com/go-mixins/microservice/redact"
+	"github.com/go-mixins/microservice/requestid"
 	"go.opencensus.io/plugin/ocgrpc"
-	"go.opencensus.io/stats/view"
 	"go.opencensus.io/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/status"
@@ -19,39 +21,75 @@ import (
 	grpcMW "github.com/grpc-ecosystem/go-grpc-middleware"
 )
 
-var grpcOnce sync.Once
-
 // Replaceable functions
 var (
 	NowFunc = time.Now
 )
 
+// JSONCodec, если задан, используется клиентами ClientMiddleware для
+// передачи всех сообщений в формате application/grpc+json. Сервер принимает
+// такие сообщения всегда, декодируя их json.Compact.
+var JSONCodec *json.Codec
+
 // ServerMiddleware создает рекомендованный набор опций сервера
 func ServerMiddleware(logger log.ContextLogger, extraMW ...grpc.UnaryServerInterceptor) []grpc.ServerOption {
-	grpcOnce.Do(func() {
-		if err := view.Register(ocgrpc.DefaultServerViews...); err != nil {
-			logger.Errorf("registering gRPC views: %+v", err)
-		}
-	})
+	if err := metrics.Register(ocgrpc.DefaultServerViews...); err != nil {
+		logger.Errorf("registering gRPC views: %+v", err)
+	}
+	chain := []grpc.UnaryServerInterceptor{
+		mdGRPC.UnaryServerInterceptor(),
+		RequestID(),
+		RequestLogging(logger),
+		ErrorsToStatus(),
+		Timeout(Timeouts),
+		Validation(),
+	}
+	chain = append(chain, extraMW...)
+	// keys are scoped to the caller, so deduplication follows authentication
+	// installed by extraMW
+	if IdempotencyStore != nil {
+		chain = append(chain, Idempotency(IdempotencyStore, IdempotencyScope))
+	}
 	return []grpc.ServerOption{
 		grpc.StatsHandler(&ocgrpc.ServerHandler{}),
-		grpc.UnaryInterceptor(grpcMW.ChainUnaryServer(
-			append([]grpc.UnaryServerInterceptor{
-				RequestLogging(logger),
-				mdGRPC.UnaryServerInterceptor(),
-				ErrorsToStatus(),
-			}, extraMW...)...,
-		)),
+		grpc.UnaryInterceptor(grpcMW.ChainUnaryServer(chain...)),
 	}
 }
 
-// RequestDebug включает логирование всех вызовов
+// RequestDebug включает логирование всех вызовов с правилами скрытия данных
+// по умолчанию. redact.Default читается при каждом вызове, поэтому правила,
+// загруженные из окружения после создания перехватчика, тоже применяются.
 func RequestDebug() grpc.UnaryServerInterceptor {
+	return requestDebug(func() redact.Rules { return redact.Default }, nil)
+}
+
+// RequestDebugWith включает логирование всех запросов и ответов, скрывая
+// чувствительные поля согласно правилам. Если codec не задан, используется
+// json.Default.
+func RequestDebugWith(rules redact.Rules, codec *json.Codec) grpc.UnaryServerInterceptor {
+	return requestDebug(func() redact.Rules { return rules }, codec)
+}
+
+func requestDebug(getRules func() redact.Rules, codec *json.Codec) grpc.UnaryServerInterceptor {
+	if codec == nil {
+		codec = json.Default
+	}
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, rErr error) {
-		reqPb, _ := req.(proto.Message)
-		jd, _ := json.Encode(reqPb)
-		log.Get(ctx).Debugf("received request: %s", jd)
-		return handler(ctx, req)
+		rules := getRules()
+		encode := func(src interface{}) []byte {
+			pb, _ := src.(proto.Message)
+			jd, _ := codec.Encode(redact.Proto(pb))
+			return rules.Truncate(rules.JSON(jd))
+		}
+		logger := log.Get(ctx)
+		logger.Debugf("received request: %s", encode(req))
+		res, err := handler(ctx, req)
+		if err != nil {
+			logger.Debugf("returned error: %v", err)
+			return res, err
+		}
+		logger.Debugf("sent response: %s", encode(res))
+		return res, err
 	}
 }
 
@@ -59,8 +97,9 @@ func RequestDebug() grpc.UnaryServerInterceptor {
 func RequestLogging(logger log.ContextLogger) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, rErr error) {
 		logger := logger.WithContext(log.M{
-			"method":   info.FullMethod,
-			"trace_id": trace.FromContext(ctx).SpanContext().TraceID.String(),
+			"method":     info.FullMethod,
+			"trace_id":   trace.FromContext(ctx).SpanContext().TraceID.String(),
+			"request_id": requestid.From(ctx),
 		})
 		ctx = log.With(ctx, logger)
 		ts := NowFunc()
@@ -87,23 +126,19 @@ func RequestLogging(logger log.ContextLogger) grpc.UnaryServerInterceptor {
 	}
 }
 
-// ErrorsToStatus пытается преобразовать ошибки обработчиков с status.Status
+// ErrorsToStatus пытается преобразовать ошибки обработчиков в status.Status.
+// Исходная ошибка записывается в лог, если она содержит больше сведений, чем
+// статус.
 func ErrorsToStatus() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, rErr error) {
 		res, err := handler(ctx, req)
-		for {
-			if _, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
-				return res, err
-			}
-			if x, ok := err.(interface{ Unwrap() error }); ok {
-				err = x.Unwrap()
-				continue
-			}
-			if x, ok := err.(interface{ Cause() error }); ok {
-				err = x.Cause()
-				continue
-			}
+		st, ok := errors.Status(err)
+		if !ok {
 			return res, err
 		}
+		if errors.Detailed(err, st) {
+			log.Get(ctx).Infof("%v: %+v", st.Code(), err)
+		}
+		return res, st.Err()
 	}
 }
@@ -0,0 +1,57 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/go-mixins/microservice/config"
+	"github.com/go-mixins/microservice/errors"
+)
+
+// TimeoutConfig defines deadlines of incoming calls. Methods are matched by
+// full name first and then by "/package.Service/*". Max caps the default
+// and method timeouts. Client deadline may only shorten the result. Zero
+// values disable respective limits.
+type TimeoutConfig struct {
+	Default time.Duration   `envconfig:"GRPC_TIMEOUT"`
+	Max     time.Duration   `envconfig:"GRPC_MAX_TIMEOUT"`
+	Methods config.Timeouts `envconfig:"GRPC_METHOD_TIMEOUTS"`
+}
+
+// Timeouts применяются ServerMiddleware к входящим вызовам
+var Timeouts TimeoutConfig
+
+func (cfg *TimeoutConfig) timeout(method string) time.Duration {
+	res := cfg.Default
+	if i := strings.LastIndexByte(method, '/'); i >= 0 {
+		if d, ok := cfg.Methods.Lookup(method, method[:i+1]+"*"); ok {
+			res = d
+		}
+	}
+	if cfg.Max > 0 && (res <= 0 || res > cfg.Max) {
+		res = cfg.Max
+	}
+	return res
+}
+
+// Timeout ограничивает время обработки вызова согласно настройкам. Ошибки
+// обработчика после истечения срока возвращаются как DeadlineExceeded.
+func Timeout(cfg TimeoutConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if timeout := cfg.timeout(info.FullMethod); timeout > 0 {
+			// earlier client deadline is kept by context.WithTimeout
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		res, err := handler(ctx, req)
+		if err != nil && ctx.Err() == context.DeadlineExceeded && errors.Code(err) != codes.DeadlineExceeded {
+			return res, errors.New(codes.DeadlineExceeded, "deadline exceeded").Wrap(err)
+		}
+		return res, err
+	}
+}
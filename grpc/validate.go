@@ -0,0 +1,19 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/go-mixins/microservice/validate"
+	"google.golang.org/grpc"
+)
+
+// Validation проверяет запросы перед вызовом обработчика и возвращает
+// codes.InvalidArgument с описанием ошибок в полях
+func Validation() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, rErr error) {
+		if err := validate.Check(req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
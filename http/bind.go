@@ -0,0 +1,219 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ajg/form"
+	"github.com/go-noodle/bind"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/go-mixins/microservice/errors"
+	pbjson "github.com/go-mixins/microservice/json"
+)
+
+// MaxMultipartMemory limits memory used for parsing multipart forms
+var MaxMultipartMemory int64 = 32 << 20
+
+// MaxBodySize limits request bodies read by binding. Zero disables the limit.
+var MaxBodySize int64 = 32 << 20
+
+// ErrBodyTooLarge is returned when request body exceeds the limit. It is
+// rendered as 413.
+var ErrBodyTooLarge = errors.New(codes.ResourceExhausted, "request body too large").WithHTTPStatus(http.StatusRequestEntityTooLarge)
+
+// limitedBody fails with ErrBodyTooLarge once more than the remaining number
+// of bytes is read
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), ErrBodyTooLarge
+	}
+	return n, err
+}
+
+type decoder struct {
+	r     *http.Request
+	codec *pbjson.Codec
+}
+
+func newDecoder(codec *pbjson.Codec) bind.Constructor {
+	return func(r *http.Request) bind.Decoder {
+		if codec == nil {
+			return decoder{r, defaultCodec(false)}
+		}
+		return decoder{r, codec}
+	}
+}
+
+// Decode dispatches on request Content-Type
+func (d decoder) Decode(dest interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(d.r.Header.Get("Content-Type"))
+	if MaxBodySize > 0 && d.r.Body != nil {
+		d.r.Body = &limitedBody{d.r.Body, MaxBodySize}
+	}
+	var err error
+	switch mediaType {
+	case "application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf":
+		err = d.decodeProto(dest)
+	case "application/x-www-form-urlencoded":
+		if err = d.r.ParseForm(); err == nil {
+			err = d.decodeValues(d.r.PostForm, dest)
+		}
+	case "multipart/form-data":
+		if err = d.r.ParseMultipartForm(MaxMultipartMemory); err == nil {
+			// binding works on a copy of the request, so its temporary files
+			// are not removed by the server
+			defer d.r.MultipartForm.RemoveAll()
+			err = d.decodeValues(d.r.MultipartForm.Value, dest)
+		}
+	default:
+		err = d.decodeJSON(dest)
+	}
+	if err != nil {
+		return decodeError(err)
+	}
+	return nil
+}
+
+func (d decoder) decodeJSON(dest interface{}) error {
+	data, err := ioutil.ReadAll(d.r.Body)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if pb, ok := dest.(proto.Message); ok {
+		if err := d.codec.Decode(data, pb); err != nil {
+			return fmt.Errorf("decode jsonpb: %w", err)
+		}
+		return nil
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("decode json: %w", err)
+	}
+	return nil
+}
+
+func (d decoder) decodeProto(dest interface{}) error {
+	pb, ok := dest.(proto.Message)
+	if !ok {
+		return fmt.Errorf("decode protobuf: %T is not a proto.Message", dest)
+	}
+	data, err := ioutil.ReadAll(d.r.Body)
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(data, pb); err != nil {
+		return fmt.Errorf("decode protobuf: %w", err)
+	}
+	return nil
+}
+
+// decodeValues binds form values. Proto messages are filled through their
+// JSON representation, so keys are field names with dots for nested
+// messages, e.g. "address.city".
+func (d decoder) decodeValues(values url.Values, dest interface{}) error {
+	pb, ok := dest.(proto.Message)
+	if !ok {
+		if err := form.DecodeValues(dest, values); err != nil {
+			return fmt.Errorf("decode form: %w", err)
+		}
+		return nil
+	}
+	doc := make(map[string]interface{})
+	for k, vv := range values {
+		setFormValue(doc, pb.ProtoReflect().Descriptor(), strings.Split(k, "."), vv)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := d.codec.Decode(data, pb); err != nil {
+		return fmt.Errorf("decode form: %w", err)
+	}
+	return nil
+}
+
+func setFormValue(dest map[string]interface{}, md protoreflect.MessageDescriptor, path []string, vv []string) {
+	fd := md.Fields().ByJSONName(path[0])
+	if fd == nil {
+		fd = md.Fields().ByName(protoreflect.Name(path[0]))
+	}
+	if fd == nil || len(vv) == 0 {
+		return
+	}
+	name := fd.JSONName()
+	if len(path) > 1 {
+		if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return
+		}
+		sub, ok := dest[name].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			dest[name] = sub
+		}
+		setFormValue(sub, fd.Message(), path[1:], vv)
+		return
+	}
+	if !fd.IsList() {
+		dest[name] = formValue(fd, vv[0])
+		return
+	}
+	list := make([]interface{}, len(vv))
+	for i, v := range vv {
+		list[i] = formValue(fd, v)
+	}
+	dest[name] = list
+}
+
+// formValue converts form strings to JSON values acceptable by protojson
+func formValue(fd protoreflect.FieldDescriptor, v string) interface{} {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	case protoreflect.EnumKind:
+		if _, err := strconv.Atoi(v); err == nil {
+			return json.Number(v)
+		}
+	}
+	return v
+}
+
+// decodeError converts decoding failure to InvalidArgument with field
+// details where they are known
+func decodeError(err error) error {
+	if errors.Is(err, ErrBodyTooLarge) {
+		return err
+	}
+	violation := errors.Field("", err.Error())
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		violation = errors.Field(typeErr.Field, fmt.Sprintf("cannot decode %s into %s", typeErr.Value, typeErr.Type))
+	}
+	return errors.InvalidArgument("invalid request body", violation).Wrap(err)
+}
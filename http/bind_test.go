@@ -0,0 +1,103 @@
+package http
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-noodle/bind"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func multipartBody(t *testing.T, fields [][2]string) (string, string) {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	for _, f := range fields {
+		if err := mw.WriteField(f[0], f[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String(), mw.FormDataContentType()
+}
+
+func TestDecode(t *testing.T) {
+	want := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("a.proto"),
+		Dependency: []string{"b.proto", "c.proto"},
+		Options:    &descriptorpb.FileOptions{GoPackage: proto.String("x/a")},
+	}
+	binary, err := proto.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multipartData, multipartType := multipartBody(t, [][2]string{
+		{"name", "a.proto"},
+		{"dependency", "b.proto"},
+		{"dependency", "c.proto"},
+		{"options.goPackage", "x/a"},
+	})
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"json", "application/json", `{"name":"a.proto","dependency":["b.proto","c.proto"],"options":{"goPackage":"x/a"}}`},
+		{"default json", "", `{"name":"a.proto","dependency":["b.proto","c.proto"],"options":{"go_package":"x/a"}}`},
+		{"protobuf", "application/x-protobuf", string(binary)},
+		{"vnd protobuf", "application/vnd.google.protobuf", string(binary)},
+		{"form", "application/x-www-form-urlencoded", "name=a.proto&dependency=b.proto&dependency=c.proto&options.go_package=x%2Fa"},
+		{"multipart", multipartType, multipartData},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+			got := new(descriptorpb.FileDescriptorProto)
+			if err := newDecoder(nil)(r).Decode(got); err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got, want) {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	defer func(size int64) { MaxBodySize = size }(MaxBodySize)
+	MaxBodySize = 16
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"invalid json", "application/json", `{"name":`, http.StatusBadRequest},
+		{"invalid protobuf", "application/x-protobuf", "\xff", http.StatusBadRequest},
+		{"large json", "application/json", `{"name":"` + strings.Repeat("a", 16) + `"}`, http.StatusRequestEntityTooLarge},
+		{"large protobuf", "application/x-protobuf", strings.Repeat("\x0a\x01a", 8), http.StatusRequestEntityTooLarge},
+		{"large form", "application/x-www-form-urlencoded", "name=" + strings.Repeat("a", 16), http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+			var err error
+			JSON(new(descriptorpb.FileDescriptorProto))(func(w http.ResponseWriter, r *http.Request) {
+				_, err = bind.Get(r)
+			})(httptest.NewRecorder(), r)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if body := NewErrorBody(r, err); body.Status != tc.status {
+				t.Errorf("expected status %d, got %d (%s)", tc.status, body.Status, body.Detail)
+			}
+		})
+	}
+}
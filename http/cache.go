@@ -0,0 +1,380 @@
+package http
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachePolicy defines caching of route responses. CacheControl is sent with
+// successful responses unless the handler sets its own. Responses are kept in
+// the server-side cache for TTL if it is positive. Vary lists request headers
+// that take part in the cache key besides Accept.
+type CachePolicy struct {
+	CacheControl string
+	TTL          time.Duration
+	Vary         []string
+}
+
+// CachedResponse is a response kept in Cache
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	Stored time.Time
+}
+
+// Cache keeps rendered responses. Implementations must be safe for
+// concurrent use.
+type Cache interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, res *CachedResponse, ttl time.Duration)
+}
+
+// CacheOption настраивает WithCache
+type CacheOption func(*cacheOptions)
+
+type cacheOptions struct {
+	resolver    RouteResolver
+	policies    map[string]CachePolicy
+	cache       Cache
+	maxSize     int
+	credentials []string
+}
+
+// CacheRoutes sets resolver used to match routes with policies
+func CacheRoutes(resolver RouteResolver) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.resolver = resolver
+	}
+}
+
+// CacheRoute sets caching policy for the route template
+func CacheRoute(route string, policy CachePolicy) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.policies[route] = policy
+	}
+}
+
+// CacheStore enables server-side caching of routes with positive TTL
+func CacheStore(cache Cache) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.cache = cache
+	}
+}
+
+// CacheMaxSize limits size of buffered responses. Larger responses are sent
+// without ETag. Default is 1 MiB.
+func CacheMaxSize(n int) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.maxSize = n
+	}
+}
+
+// CacheCredentials sets request headers carrying credentials. Requests with
+// any of them are not served from the server-side cache and their responses
+// are not stored, unless the policy varies on the header. Default is
+// Authorization, Cookie and X-Api-Key.
+func CacheCredentials(headers ...string) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.credentials = headers
+	}
+}
+
+// WithCache обвязывает http.Handler для расчёта ETag ответов на GET и HEAD,
+// ответа 304 на If-None-Match и кэширования ответов согласно политикам
+// маршрутов. Обрабатываются только маршруты с политикой, потоковые ответы
+// передаются без изменений.
+func WithCache(src http.Handler, options ...CacheOption) http.Handler {
+	opts := cacheOptions{
+		resolver:    DefaultRouteResolver,
+		policies:    make(map[string]CachePolicy),
+		maxSize:     1 << 20,
+		credentials: []string{"Authorization", "Cookie", "X-Api-Key"},
+	}
+	for _, o := range options {
+		o(&opts)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			src.ServeHTTP(w, r)
+			return
+		}
+		policy, ok := opts.policies[opts.resolver.Route(r)]
+		if !ok {
+			src.ServeHTTP(w, r)
+			return
+		}
+		vary := append([]string{"Accept"}, policy.Vary...)
+		addVary(w.Header(), vary...)
+		var key string
+		if opts.cache != nil && policy.TTL > 0 && cacheable(r, vary, opts.credentials) {
+			key = cacheKey(r, vary)
+			if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+				if res, ok := opts.cache.Get(key); ok {
+					hdr := w.Header()
+					for k, vv := range res.Header {
+						hdr[k] = append([]string(nil), vv...)
+					}
+					hdr.Set("Age", strconv.Itoa(int(NowFunc().Sub(res.Stored)/time.Second)))
+					writeConditional(w, r, res.Status, res.Body)
+					return
+				}
+			}
+		}
+		before := w.Header().Clone()
+		cw := &cacheWriter{ResponseWriter: w, maxSize: opts.maxSize}
+		src.ServeHTTP(exposeCapabilities(cw, w), r)
+		if cw.passthrough || cw.hijacked {
+			return
+		}
+		status := cw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		hdr := w.Header()
+		// bodiless HEAD responses have no tag to match the GET one
+		bodiless := r.Method == http.MethodHead && len(cw.buf) == 0
+		if status == http.StatusOK {
+			// the tag is weak since compression outside changes the bytes
+			if hdr.Get("ETag") == "" && !bodiless {
+				sum := sha256.Sum256(cw.buf)
+				hdr.Set("ETag", `W/"`+base64.RawURLEncoding.EncodeToString(sum[:12])+`"`)
+			}
+			if policy.CacheControl != "" && hdr.Get("Cache-Control") == "" {
+				hdr.Set("Cache-Control", policy.CacheControl)
+			}
+			if key != "" && r.Method == http.MethodGet && storable(hdr) {
+				opts.cache.Set(key, &CachedResponse{
+					Status: status,
+					Header: headerDiff(before, hdr),
+					Body:   cw.buf,
+					Stored: NowFunc(),
+				}, policy.TTL)
+			}
+		}
+		writeConditional(w, r, status, cw.buf)
+	})
+}
+
+// writeConditional sends response or 304 if If-None-Match matches its ETag.
+// Content-Length of HEAD responses is left to the handler if the body is
+// not known.
+func writeConditional(w http.ResponseWriter, r *http.Request, status int, body []byte) {
+	hdr := w.Header()
+	if status == http.StatusOK && etagMatch(r.Header.Get("If-None-Match"), hdr.Get("ETag")) {
+		hdr.Del("Content-Type")
+		hdr.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	bodiless := r.Method == http.MethodHead && len(body) == 0
+	if hdr.Get("Content-Length") == "" && !bodiless && status != http.StatusNoContent && status != http.StatusNotModified {
+		hdr.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+// etagMatch performs weak comparison of If-None-Match list with the ETag
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheable rejects requests with credentials unless the policy varies on them
+func cacheable(r *http.Request, vary, credentials []string) bool {
+	for _, h := range credentials {
+		if r.Header.Get(h) == "" {
+			continue
+		}
+		found := false
+		for _, v := range vary {
+			found = found || strings.EqualFold(v, h)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func storable(hdr http.Header) bool {
+	cc := hdr.Get("Cache-Control")
+	return hdr.Get("Set-Cookie") == "" && !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+// cacheKey combines request path, sorted query and values of vary headers
+func cacheKey(r *http.Request, vary []string) string {
+	var sb strings.Builder
+	sb.WriteString(r.URL.Path)
+	sb.WriteByte('?')
+	sb.WriteString(r.URL.Query().Encode())
+	names := make([]string, len(vary))
+	for i, h := range vary {
+		names[i] = http.CanonicalHeaderKey(h)
+	}
+	sort.Strings(names)
+	for _, h := range names {
+		fmt.Fprintf(&sb, "\n%s: %s", h, strings.Join(r.Header.Values(h), ","))
+	}
+	return sb.String()
+}
+
+// cacheWriter buffers response body until the handler returns. Flushed or
+// too large responses are passed through as is.
+type cacheWriter struct {
+	http.ResponseWriter
+	maxSize     int
+	buf         []byte
+	status      int
+	passthrough bool
+	hijacked    bool
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	w.buf = append(w.buf, data...)
+	if len(w.buf) > w.maxSize {
+		if err := w.pass(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// pass sends buffered response and switches the writer to passthrough mode
+func (w *cacheWriter) pass() error {
+	w.passthrough = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *cacheWriter) Flush() {
+	if !w.passthrough {
+		_ = w.pass()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not implement http.Hijacker", w.ResponseWriter)
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (w *cacheWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+type cacheEntry struct {
+	key     string
+	res     *CachedResponse
+	expires time.Time
+}
+
+// MemoryCache is an in-process LRU Cache
+type MemoryCache struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	lru   *list.List
+}
+
+var _ Cache = (*MemoryCache)(nil)
+
+// NewMemoryCache creates cache holding at most size responses
+func NewMemoryCache(size int) *MemoryCache {
+	return &MemoryCache{
+		size:  size,
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+// Get implements Cache
+func (c *MemoryCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if !NowFunc().Before(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.res, true
+}
+
+// Set implements Cache
+func (c *MemoryCache) Set(key string, res *CachedResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	c.items[key] = c.lru.PushFront(&cacheEntry{key: key, res: res, expires: NowFunc().Add(ttl)})
+	for c.size > 0 && c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *MemoryCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry).key)
+}
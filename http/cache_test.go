@@ -0,0 +1,118 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	calls := 0
+	h := WithCache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		addVary(w.Header(), "Accept")
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodHead {
+			_, _ = io.WriteString(w, `{"id":1}`)
+		}
+	}),
+		CacheRoutes(RouteResolverFunc(func(r *http.Request) string { return r.URL.Path })),
+		CacheRoute("/items", CachePolicy{CacheControl: "public, max-age=60", TTL: time.Minute}),
+		CacheRoute("/users", CachePolicy{TTL: time.Minute, Vary: []string{"Authorization"}}),
+		CacheRoute("/tagged", CachePolicy{}),
+		CacheStore(NewMemoryCache(10)),
+	)
+	get := func(method, path string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	w := get("GET", "/tagged", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Content-Length") != "8" {
+		t.Fatalf("unexpected response %d, ETag %q", w.Code, etag)
+	}
+	for _, tc := range []struct {
+		name         string
+		method       string
+		path         string
+		header       map[string]string
+		status       int
+		etag         bool
+		length       string
+		cached       bool
+		cacheControl string
+	}{
+		{"no policy", "GET", "/other", nil, http.StatusOK, false, "", false, ""},
+		{"not modified", "GET", "/tagged", map[string]string{"If-None-Match": etag}, http.StatusNotModified, true, "", false, ""},
+		{"weak comparison", "GET", "/tagged", map[string]string{"If-None-Match": `"x", ` + etag[2:]}, http.StatusNotModified, true, "", false, ""},
+		{"modified", "GET", "/tagged", map[string]string{"If-None-Match": `"x"`}, http.StatusOK, true, "8", false, ""},
+		{"bodiless HEAD", "HEAD", "/tagged", nil, http.StatusOK, false, "", false, ""},
+		{"first GET", "GET", "/items", nil, http.StatusOK, true, "8", false, "public, max-age=60"},
+		{"cached GET", "GET", "/items", nil, http.StatusOK, true, "8", true, "public, max-age=60"},
+		{"cached HEAD", "HEAD", "/items", nil, http.StatusOK, true, "8", true, "public, max-age=60"},
+		{"no-cache", "GET", "/items", map[string]string{"Cache-Control": "no-cache"}, http.StatusOK, true, "8", false, "public, max-age=60"},
+		{"authorization", "GET", "/items", map[string]string{"Authorization": "Bearer x"}, http.StatusOK, true, "8", false, "public, max-age=60"},
+		{"cookie", "GET", "/items", map[string]string{"Cookie": "session=x"}, http.StatusOK, true, "8", false, "public, max-age=60"},
+		{"api key", "GET", "/items", map[string]string{"X-Api-Key": "x"}, http.StatusOK, true, "8", false, "public, max-age=60"},
+		{"first authorized", "GET", "/users", map[string]string{"Authorization": "Bearer x"}, http.StatusOK, true, "8", false, ""},
+		{"cached authorized", "GET", "/users", map[string]string{"Authorization": "Bearer x"}, http.StatusOK, true, "8", true, ""},
+		{"other credentials", "GET", "/users", map[string]string{"Authorization": "Bearer y"}, http.StatusOK, true, "8", false, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			before := calls
+			w := get(tc.method, tc.path, tc.header)
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, w.Code)
+			}
+			if got := w.Header().Get("ETag") != ""; got != tc.etag {
+				t.Errorf("expected ETag %v, got %q", tc.etag, w.Header().Get("ETag"))
+			}
+			if got := w.Header().Get("Content-Length"); got != tc.length {
+				t.Errorf("expected Content-Length %q, got %q", tc.length, got)
+			}
+			if cached := calls == before; cached != tc.cached {
+				t.Errorf("expected cached %v", tc.cached)
+			}
+			if cached := w.Header().Get("Age") != ""; cached != tc.cached {
+				t.Errorf("expected Age header %v", tc.cached)
+			}
+			if got := w.Header().Get("Cache-Control"); got != tc.cacheControl {
+				t.Errorf("expected Cache-Control %q, got %q", tc.cacheControl, got)
+			}
+			seen := map[string]bool{}
+			for _, v := range w.Header().Values("Vary") {
+				if seen[v] {
+					t.Errorf("duplicate Vary %q", w.Header().Values("Vary"))
+				}
+				seen[v] = true
+			}
+		})
+	}
+}
+
+func TestCacheCredentials(t *testing.T) {
+	calls := 0
+	h := WithCache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = io.WriteString(w, "ok")
+	}),
+		CacheRoute("/", CachePolicy{TTL: time.Minute}),
+		CacheStore(NewMemoryCache(10)),
+		CacheCredentials("X-Token"),
+	)
+	for _, header := range []string{"X-Token", "X-Token", "Authorization", "Authorization"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(header, "secret")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if calls != 3 {
+		t.Errorf("expected only requests without configured credentials to be cached, got %d calls", calls)
+	}
+}
@@ -0,0 +1,143 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ProxyConfig lists reverse proxies trusted to report client address in
+// Forwarded, X-Forwarded-For and X-Real-Ip headers. Only loopback is trusted
+// by default, private networks of ingress or load balancers must be added
+// explicitly, e.g. "127.0.0.0/8,::1/128,10.0.0.0/8".
+type ProxyConfig struct {
+	TrustedProxies Networks `envconfig:"HTTP_TRUSTED_PROXIES" default:"127.0.0.0/8,::1/128"`
+}
+
+// Networks is a list of IP networks. It is decoded from comma separated
+// CIDRs or single addresses.
+type Networks []*net.IPNet
+
+// Decode implements envconfig.Decoder
+func (n *Networks) Decode(value string) error {
+	res := Networks{}
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return fmt.Errorf("invalid IP address %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return fmt.Errorf("invalid network: %w", err)
+		}
+		res = append(res, network)
+	}
+	*n = res
+	return nil
+}
+
+// Contains reports whether ip belongs to any of the networks
+func (n Networks) Contains(ip net.IP) bool {
+	for _, network := range n {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type clientIPKey struct{}
+
+// ClientIP returns client address resolved by WithClientIP
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// WithClientIP обвязывает http.Handler для определения адреса клиента с
+// учётом доверенных прокси. Адрес доступен через ClientIP.
+func WithClientIP(src http.Handler, trusted Networks) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPKey{}, resolveClientIP(r, trusted))
+		src.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientIP returns address resolved by WithClientIP or the peer address if
+// the middleware is not installed
+func clientIP(r *http.Request) string {
+	if ip := ClientIP(r.Context()); ip != "" {
+		return ip
+	}
+	return resolveClientIP(r, nil)
+}
+
+// resolveClientIP trusts forwarding headers only when the peer is a trusted
+// proxy. Hops are walked right to left, and the first untrusted address is
+// the client.
+func resolveClientIP(r *http.Request, trusted Networks) string {
+	remote := hostIP(r.RemoteAddr)
+	ip := net.ParseIP(remote)
+	if ip == nil || !trusted.Contains(ip) {
+		return remote
+	}
+	var hops []string
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		hops = forwardedFor(values)
+	} else if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, v := range values {
+			hops = append(hops, strings.Split(v, ",")...)
+		}
+	} else if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-Ip"))); realIP != nil {
+		return realIP.String()
+	}
+	res := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hostIP(strings.TrimSpace(hops[i])))
+		if ip == nil {
+			break
+		}
+		res = ip.String()
+		if !trusted.Contains(ip) {
+			break
+		}
+	}
+	return res
+}
+
+// forwardedFor extracts "for" parameters of RFC 7239 Forwarded header
+func forwardedFor(values []string) []string {
+	var res []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				pair = strings.TrimSpace(pair)
+				if i := strings.IndexByte(pair, '='); i >= 0 && strings.EqualFold(pair[:i], "for") {
+					res = append(res, strings.Trim(pair[i+1:], `"`))
+				}
+			}
+		}
+	}
+	return res
+}
+
+// hostIP strips port and IPv6 brackets from address
+func hostIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
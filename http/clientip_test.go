@@ -0,0 +1,74 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	var trusted Networks
+	if err := trusted.Decode("127.0.0.0/8,::1/128,10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name   string
+		remote string
+		header map[string]string
+		ip     string
+	}{
+		{"direct", "203.0.113.1:1234", nil, "203.0.113.1"},
+		{"untrusted peer", "203.0.113.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.1"},
+		{"untrusted peer Forwarded", "203.0.113.1:1234", map[string]string{"Forwarded": "for=198.51.100.1"}, "203.0.113.1"},
+		{"trusted peer without headers", "127.0.0.1:1234", nil, "127.0.0.1"},
+		{"X-Forwarded-For", "127.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"X-Forwarded-For chain", "127.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"spoofed X-Forwarded-For", "127.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"invalid hop", "127.0.0.1:1234", map[string]string{"X-Forwarded-For": "garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"Forwarded", "127.0.0.1:1234", map[string]string{"Forwarded": `for=198.51.100.1;proto=https, for="10.0.0.2:8080"`}, "198.51.100.1"},
+		{"Forwarded IPv6", "[::1]:1234", map[string]string{"Forwarded": `for="[2001:db8::1]:4711"`}, "2001:db8::1"},
+		{"Forwarded over X-Forwarded-For", "127.0.0.1:1234", map[string]string{"Forwarded": "for=198.51.100.1", "X-Forwarded-For": "198.51.100.2"}, "198.51.100.1"},
+		{"X-Real-Ip", "127.0.0.1:1234", map[string]string{"X-Real-Ip": "198.51.100.1"}, "198.51.100.1"},
+		{"untrusted X-Real-Ip", "203.0.113.1:1234", map[string]string{"X-Real-Ip": "198.51.100.1"}, "203.0.113.1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			h := WithClientIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r.Context())
+			}), trusted)
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remote
+			for k, v := range tc.header {
+				r.Header.Set(k, v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tc.ip {
+				t.Errorf("expected %s, got %s", tc.ip, got)
+			}
+		})
+	}
+}
+
+func TestNetworksDecode(t *testing.T) {
+	var n Networks
+	if err := n.Decode("127.0.0.0/8, ::1, 10.1.2.3"); err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{
+		"127.1.2.3": true,
+		"::1":       true,
+		"10.1.2.3":  true,
+		"10.1.2.4":  false,
+		"::2":       false,
+	} {
+		if got := n.Contains(net.ParseIP(ip)); got != want {
+			t.Errorf("%s: expected %v, got %v", ip, want, got)
+		}
+	}
+	for _, s := range []string{"300.0.0.1", "10.0.0.0/33"} {
+		if err := n.Decode(s); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package http
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/codes"
+
+	"github.com/go-mixins/microservice/errors"
+)
+
+// CompressConfig defines response compression and request decompression
+// policy. Encodings are listed in server preference order, empty list
+// disables response compression. ContentTypes may contain patterns like
+// "text/*", event streams are never compressed. Decompressed request bodies
+// are limited to MaxRequestSize bytes unless it is zero.
+type CompressConfig struct {
+	Encodings      []string `envconfig:"HTTP_COMPRESS_ENCODINGS" default:"zstd,br,gzip"`
+	MinSize        int      `envconfig:"HTTP_COMPRESS_MIN_SIZE" default:"1024"`
+	ContentTypes   []string `envconfig:"HTTP_COMPRESS_TYPES" default:"application/json,application/problem+json,application/x-ndjson,application/yaml,application/xml,application/javascript,image/svg+xml,text/*"`
+	MaxRequestSize int64    `envconfig:"HTTP_DECOMPRESS_LIMIT" default:"16777216"`
+}
+
+// encoder is implemented by the pooled compressing writers
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// compressor pools encoders and creates decoders of request bodies. Decoders
+// may use the limit of decompressed size to bound their memory.
+type compressor struct {
+	writers sync.Pool
+	reader  func(r io.Reader, limit int64) (io.ReadCloser, error)
+}
+
+var compressors = map[string]*compressor{
+	"gzip": {
+		writers: sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }},
+		reader: func(r io.Reader, _ int64) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	"br": {
+		writers: sync.Pool{New: func() interface{} { return brotli.NewWriter(nil) }},
+		reader: func(r io.Reader, _ int64) (io.ReadCloser, error) {
+			return io.NopCloser(brotli.NewReader(r)), nil
+		},
+	},
+	"zstd": {
+		writers: sync.Pool{New: func() interface{} {
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+			return w
+		}},
+		reader: func(r io.Reader, limit int64) (io.ReadCloser, error) {
+			opts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+			if limit > 0 {
+				window := uint64(limit)
+				if window < zstdMinWindow {
+					window = zstdMinWindow
+				}
+				opts = append(opts, zstd.WithDecoderMaxMemory(window), zstd.WithDecoderMaxWindow(window))
+			}
+			d, err := zstd.NewReader(r, opts...)
+			if err != nil {
+				return nil, err
+			}
+			return zstdBody{d.IOReadCloser()}, nil
+		},
+	},
+}
+
+// zstdMinWindow is the window of streaming zstd encoders with default level.
+// Decoder window is limited by the decompressed size limit, but not below it,
+// because streaming encoders declare the window regardless of content size.
+const zstdMinWindow = 8 << 20
+
+// zstdBody reports frames exceeding the decoder limits as ErrBodyTooLarge
+type zstdBody struct {
+	io.ReadCloser
+}
+
+func (b zstdBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		err = ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func (c *compressor) get(w io.Writer) encoder {
+	enc := c.writers.Get().(encoder)
+	enc.Reset(w)
+	return enc
+}
+
+// WithCompression обвязывает http.Handler для сжатия ответов согласно
+// Accept-Encoding и распаковки тел запросов согласно Content-Encoding
+func WithCompression(src http.Handler, cfg CompressConfig) http.Handler {
+	var encodings []string
+	for _, name := range cfg.Encodings {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := compressors[name]; ok {
+			encodings = append(encodings, name)
+		}
+	}
+	supported := strings.Join(encodings, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := decompressRequest(r, cfg.MaxRequestSize); err != nil {
+			if errors.Code(err) == codes.Unimplemented {
+				w.Header().Set("Accept-Encoding", supported)
+			}
+			writeError(w, r, NewErrorBody(r, err))
+			return
+		}
+		if len(encodings) == 0 {
+			src.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptEncoding(r.Header.Get("Accept-Encoding"), encodings)
+		if encoding == "" || r.Method == http.MethodHead {
+			src.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, cfg: &cfg, encoding: encoding}
+		completed := false
+		defer func() {
+			// on panic the buffered response must not be sent as successful
+			if completed {
+				cw.close()
+			}
+		}()
+		src.ServeHTTP(exposeCapabilities(cw, w), r)
+		completed = true
+	})
+}
+
+// acceptEncoding selects the encoding with the highest client quality,
+// preferring the server order on ties
+func acceptEncoding(header string, supported []string) string {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, q := part, 1.0
+		if i := strings.IndexByte(part, ';'); i >= 0 {
+			name = part[:i]
+			param := strings.TrimSpace(part[i+1:])
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					continue
+				}
+				q = v
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+	res, best := "", 0.0
+	for _, enc := range supported {
+		q, ok := accepted[enc]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > best {
+			res, best = enc, q
+		}
+	}
+	return res
+}
+
+func decompressRequest(r *http.Request, limit int64) error {
+	contentEncoding := r.Header.Get("Content-Encoding")
+	if contentEncoding == "" || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	body := &decompressedBody{Reader: r.Body, closers: []io.Closer{r.Body}}
+	codings := strings.Split(contentEncoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		name := strings.ToLower(strings.TrimSpace(codings[i]))
+		switch name {
+		case "identity", "":
+			continue
+		case "x-gzip":
+			name = "gzip"
+		}
+		c, ok := compressors[name]
+		if !ok {
+			return errors.Errorf(codes.Unimplemented, "unsupported content encoding %q", name).WithHTTPStatus(http.StatusUnsupportedMediaType)
+		}
+		rc, err := c.reader(body.Reader, limit)
+		if err != nil {
+			return errors.New(codes.InvalidArgument, "invalid request body encoding").Wrap(err)
+		}
+		body.Reader = rc
+		body.closers = append(body.closers, rc)
+	}
+	r.Body = body
+	if limit > 0 {
+		r.Body = &limitedBody{body, limit}
+	}
+	r.ContentLength = -1
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	return nil
+}
+
+// decompressedBody closes all decoders together with the original body
+type decompressedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decompressedBody) Close() error {
+	var err error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		if e := b.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// compressWriter buffers response body until MinSize bytes are written and
+// then decides whether to compress it according to response headers
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      *CompressConfig
+	encoding string
+	enc      encoder
+	buf      []byte
+	status   int
+	decided  bool
+	hijacked bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status != 0 {
+		return
+	}
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		if code >= http.StatusOK {
+			w.decided = true
+		}
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+	w.buf = append(w.buf, data...)
+	if len(w.buf) >= w.cfg.MinSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(true)
+	}
+	if w.enc != nil {
+		_ = w.enc.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not implement http.Hijacker", w.ResponseWriter)
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (w *compressWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// decide sends response headers, enabling compression if allowed, and
+// writes buffered data
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	hdr := w.Header()
+	if compress && w.compressible(hdr) {
+		hdr.Del("Content-Length")
+		hdr.Set("Content-Encoding", w.encoding)
+		if etag := hdr.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			hdr.Set("ETag", "W/"+etag)
+		}
+		w.enc = compressors[w.encoding].get(w.ResponseWriter)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
+
+func (w *compressWriter) compressible(hdr http.Header) bool {
+	if hdr.Get("Content-Encoding") != "" || hdr.Get("Content-Range") != "" ||
+		strings.Contains(hdr.Get("Cache-Control"), "no-transform") {
+		return false
+	}
+	if n, err := strconv.Atoi(hdr.Get("Content-Length")); err == nil && n < w.cfg.MinSize {
+		return false
+	}
+	contentType := hdr.Get("Content-Type")
+	if contentType == "" {
+		if len(w.buf) == 0 {
+			return false
+		}
+		contentType = http.DetectContentType(w.buf)
+		hdr.Set("Content-Type", contentType)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == ContentTypeEventStream {
+		return false
+	}
+	for _, pattern := range w.cfg.ContentTypes {
+		if ok, _ := path.Match(strings.ToLower(strings.TrimSpace(pattern)), mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *compressWriter) close() {
+	if w.hijacked {
+		return
+	}
+	if !w.decided && (w.status != 0 || len(w.buf) > 0) {
+		_ = w.decide(false)
+	}
+	if w.enc != nil {
+		_ = w.enc.Close()
+		compressors[w.encoding].writers.Put(w.enc)
+		w.enc = nil
+	}
+}
@@ -0,0 +1,208 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var testCompressConfig = CompressConfig{
+	Encodings:      []string{"zstd", "br", "gzip"},
+	MinSize:        16,
+	ContentTypes:   []string{"application/json", "text/*"},
+	MaxRequestSize: 1024,
+}
+
+func decodeBody(t *testing.T, encoding string, data []byte) string {
+	t.Helper()
+	var (
+		r   io.Reader
+		err error
+	)
+	switch encoding {
+	case "":
+		return string(data)
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(data))
+	case "zstd":
+		r, err = zstd.NewReader(bytes.NewReader(data))
+	default:
+		t.Fatalf("unexpected encoding %q", encoding)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(res)
+}
+
+func TestCompressResponse(t *testing.T) {
+	large := `{"data":"` + strings.Repeat("x", 64) + `"}`
+	for _, tc := range []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		contentType    string
+		cacheControl   string
+		body           string
+		encoding       string
+	}{
+		{"server preference", "GET", "gzip, br, zstd", "application/json", "", large, "zstd"},
+		{"client quality", "GET", "gzip;q=1, br;q=0.5", "application/json", "", large, "gzip"},
+		{"any encoding", "GET", "*", "application/json", "", large, "zstd"},
+		{"excluded encoding", "GET", "*, zstd;q=0", "application/json", "", large, "br"},
+		{"identity only", "GET", "identity", "application/json", "", large, ""},
+		{"no header", "GET", "", "application/json", "", large, ""},
+		{"small body", "GET", "gzip", "application/json", "", `{}`, ""},
+		{"text pattern", "GET", "gzip", "text/plain; charset=utf-8", "", large, "gzip"},
+		{"detected type", "GET", "gzip", "", "", "<html>" + large, "gzip"},
+		{"other type", "GET", "gzip", "image/png", "", large, ""},
+		{"event stream", "GET", "gzip", ContentTypeEventStream, "", large, ""},
+		{"no-transform", "GET", "gzip", "application/json", "no-transform", large, ""},
+		{"HEAD", "HEAD", "gzip", "application/json", "", "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := WithCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.contentType != "" {
+					w.Header().Set("Content-Type", tc.contentType)
+				}
+				if tc.cacheControl != "" {
+					w.Header().Set("Cache-Control", tc.cacheControl)
+				}
+				w.Header().Set("ETag", `"v1"`)
+				_, _ = io.WriteString(w, tc.body)
+			}), testCompressConfig)
+			r := httptest.NewRequest(tc.method, "/", nil)
+			r.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got := w.Header().Get("Content-Encoding"); got != tc.encoding {
+				t.Fatalf("expected encoding %q, got %q", tc.encoding, got)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("unexpected Vary %q", got)
+			}
+			etag := `"v1"`
+			if tc.encoding != "" {
+				etag = `W/"v1"`
+			}
+			if got := w.Header().Get("ETag"); got != etag {
+				t.Errorf("expected ETag %s, got %s", etag, got)
+			}
+			if got := decodeBody(t, tc.encoding, w.Body.Bytes()); got != tc.body {
+				t.Errorf("expected body %q, got %q", tc.body, got)
+			}
+		})
+	}
+}
+
+func TestCompressPanic(t *testing.T) {
+	h := WithCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"partial":`)
+		panic("boom")
+	}), testCompressConfig)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	func() {
+		defer func() { _ = recover() }()
+		h.ServeHTTP(w, r)
+	}()
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Flushed {
+		t.Errorf("buffered response is sent: %d %q", w.Code, w.Body.String())
+	}
+}
+
+func compressData(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	enc := compressors[encoding].get(buf)
+	if _, err := enc.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdData(t *testing.T, data []byte, opts ...zstd.EOption) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	enc, err := zstd.NewWriter(buf, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enc.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	// flushed frame header declares the window instead of content size
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressRequest(t *testing.T) {
+	small := bytes.Repeat([]byte("a"), 1024)
+	large := bytes.Repeat([]byte("a"), 1025)
+	for _, tc := range []struct {
+		name     string
+		encoding string
+		body     []byte
+		status   int
+	}{
+		{"gzip", "gzip", compressData(t, "gzip", small), http.StatusOK},
+		{"x-gzip", "x-gzip", compressData(t, "gzip", small), http.StatusOK},
+		{"br", "br", compressData(t, "br", small), http.StatusOK},
+		{"zstd", "zstd", compressData(t, "zstd", small), http.StatusOK},
+		{"identity", "identity", small, http.StatusOK},
+		{"gzip over limit", "gzip", compressData(t, "gzip", large), http.StatusRequestEntityTooLarge},
+		{"br over limit", "br", compressData(t, "br", large), http.StatusRequestEntityTooLarge},
+		{"zstd over limit", "zstd", compressData(t, "zstd", large), http.StatusRequestEntityTooLarge},
+		{"zstd streaming", "zstd", zstdData(t, small), http.StatusOK},
+		{"zstd window over limit", "zstd", zstdData(t, small, zstd.WithWindowSize(2*zstdMinWindow)), http.StatusRequestEntityTooLarge},
+		{"unsupported", "compress", small, http.StatusUnsupportedMediaType},
+		{"invalid gzip", "gzip", small, http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := WithCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					RenderError(w, r, err)
+					return
+				}
+				if !bytes.Equal(data, small) {
+					t.Errorf("unexpected body of %d bytes", len(data))
+				}
+			}), testCompressConfig)
+			r := httptest.NewRequest("POST", "/", bytes.NewReader(tc.body))
+			r.Header.Set("Content-Encoding", tc.encoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Errorf("expected status %d, got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+			if tc.status == http.StatusUnsupportedMediaType && w.Header().Get("Accept-Encoding") != "zstd, br, gzip" {
+				t.Errorf("unexpected Accept-Encoding %q", w.Header().Get("Accept-Encoding"))
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig defines cross-origin resource sharing policy. Origins may be
+// exact, "*" for any origin or contain wildcard subdomain, e.g.
+// "https://*.example.com". Origins allowed only by "*" get literal "*" without
+// credentials. Empty AllowedHeaders reflect headers requested by the client.
+type CORSConfig struct {
+	AllowedOrigins   []string      `envconfig:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `envconfig:"CORS_ALLOWED_METHODS" default:"GET,HEAD,POST,PUT,PATCH,DELETE"`
+	AllowedHeaders   []string      `envconfig:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders   []string      `envconfig:"CORS_EXPOSED_HEADERS" default:"X-Trace-ID"`
+	AllowCredentials bool          `envconfig:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `envconfig:"CORS_MAX_AGE" default:"10m"`
+}
+
+// allowOrigin reports whether the origin is allowed. The second result is
+// true if it is allowed only by "*".
+func (cfg *CORSConfig) allowOrigin(origin string) (bool, bool) {
+	origin = strings.ToLower(origin)
+	anyOrigin := false
+	for _, o := range cfg.AllowedOrigins {
+		o = strings.ToLower(o)
+		if o == "*" {
+			anyOrigin = true
+			continue
+		}
+		if o == origin {
+			return true, false
+		}
+		if i := strings.Index(o, "*."); i >= 0 {
+			prefix, suffix := o[:i], o[i+1:]
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) && len(origin) > len(prefix)+len(suffix) {
+				return true, false
+			}
+		}
+	}
+	return anyOrigin, anyOrigin
+}
+
+func (cfg *CORSConfig) allowMethod(method string) bool {
+	if method == http.MethodOptions {
+		return true
+	}
+	for _, m := range cfg.AllowedMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithCORS обвязывает http.Handler для поддержки CORS, отвечая на
+// предварительные запросы OPTIONS без вызова src
+func WithCORS(src http.Handler, cfg CORSConfig) http.Handler {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge / time.Second))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		hdr := w.Header()
+		hdr.Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		allowed, anyOrigin := cfg.allowOrigin(origin)
+		if origin == "" || !allowed {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			src.ServeHTTP(w, r)
+			return
+		}
+		if anyOrigin {
+			hdr.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			hdr.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials && !anyOrigin {
+			hdr.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if exposed != "" {
+				hdr.Set("Access-Control-Expose-Headers", exposed)
+			}
+			src.ServeHTTP(w, r)
+			return
+		}
+		hdr.Add("Vary", "Access-Control-Request-Method")
+		hdr.Add("Vary", "Access-Control-Request-Headers")
+		if !cfg.allowMethod(r.Header.Get("Access-Control-Request-Method")) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		hdr.Set("Access-Control-Allow-Methods", methods)
+		if requested := r.Header.Get("Access-Control-Request-Headers"); headers == "" || headers == "*" {
+			if requested != "" {
+				hdr.Set("Access-Control-Allow-Headers", requested)
+			}
+		} else {
+			hdr.Set("Access-Control-Allow-Headers", headers)
+		}
+		if cfg.MaxAge > 0 {
+			hdr.Set("Access-Control-Max-Age", maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,165 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	cfg := CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org", "*"},
+		AllowedMethods:   []string{"GET", "POST"},
+		ExposedHeaders:   []string{"X-Trace-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	for _, tc := range []struct {
+		name    string
+		cfg     CORSConfig
+		method  string
+		header  map[string]string
+		status  int
+		called  bool
+		headers map[string]string
+	}{
+		{
+			name:   "same origin",
+			cfg:    cfg,
+			method: "GET",
+			status: http.StatusOK,
+			called: true,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:   "exact origin with credentials",
+			cfg:    cfg,
+			method: "GET",
+			header: map[string]string{"Origin": "https://app.example.com"},
+			status: http.StatusOK,
+			called: true,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Trace-ID",
+			},
+		},
+		{
+			name:   "subdomain wildcard",
+			cfg:    cfg,
+			method: "GET",
+			header: map[string]string{"Origin": "https://api.example.org"},
+			status: http.StatusOK,
+			called: true,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "https://api.example.org",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			name:   "any origin without credentials",
+			cfg:    cfg,
+			method: "GET",
+			header: map[string]string{"Origin": "https://evil.test"},
+			status: http.StatusOK,
+			called: true,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+		{
+			name:   "disallowed origin",
+			cfg:    CORSConfig{AllowedOrigins: []string{"https://app.example.com"}},
+			method: "GET",
+			header: map[string]string{"Origin": "https://evil.test"},
+			status: http.StatusOK,
+			called: true,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Vary":                        "Origin",
+			},
+		},
+		{
+			name:   "preflight",
+			cfg:    cfg,
+			method: "OPTIONS",
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "Content-Type, X-Request-ID",
+			},
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, POST",
+				"Access-Control-Allow-Headers":     "Content-Type, X-Request-ID",
+				"Access-Control-Max-Age":           "600",
+				"Access-Control-Expose-Headers":    "",
+			},
+		},
+		{
+			name:   "preflight of disallowed method",
+			cfg:    cfg,
+			method: "OPTIONS",
+			header: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+		{
+			name:   "preflight from disallowed origin",
+			cfg:    CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowedMethods: []string{"GET"}},
+			method: "OPTIONS",
+			header: map[string]string{
+				"Origin":                        "https://evil.test",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":  "",
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+		{
+			name:   "plain OPTIONS request",
+			cfg:    cfg,
+			method: "OPTIONS",
+			header: map[string]string{"Origin": "https://app.example.com"},
+			status: http.StatusOK,
+			called: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			called := false
+			h := WithCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}), tc.cfg)
+			r := httptest.NewRequest(tc.method, "/", nil)
+			for k, v := range tc.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Errorf("expected status %d, got %d", tc.status, w.Code)
+			}
+			if called != tc.called {
+				t.Errorf("expected handler call to be %v", tc.called)
+			}
+			for k, v := range tc.headers {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("expected %s %q, got %q", k, v, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package http
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mixins/log"
+	"github.com/go-noodle/bind"
+	"github.com/go-noodle/render"
+	"go.opencensus.io/trace"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-mixins/microservice/errors"
+)
+
+// ErrorBody is the JSON representation of error responses. It follows RFC
+// 7807 with gRPC status code name, trace ID and status details as extensions.
+type ErrorBody struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Code     string            `json:"code"`
+	TraceID  string            `json:"trace_id,omitempty"`
+	Details  []json.RawMessage `json:"details,omitempty"`
+
+	retryAfter time.Duration
+}
+
+// Content types of error responses
+const (
+	ErrorContentType   = "application/json"
+	ProblemContentType = "application/problem+json"
+)
+
+var httpStatuses = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// HTTPStatus maps gRPC code to HTTP status code
+func HTTPStatus(c codes.Code) int {
+	if res, ok := httpStatuses[c]; ok {
+		return res
+	}
+	return http.StatusInternalServerError
+}
+
+// Status finds gRPC status in the error chain in the same way as
+// grpc.ErrorsToStatus does. Binding errors without status are converted to
+// InvalidArgument, even if wrapped. The second result is false if the error
+// has no status.
+func Status(err error) (*status.Status, bool) {
+	if st, ok := errors.Status(err); ok {
+		return st, true
+	}
+	if cause := bindingCause(err); cause != nil {
+		if st, ok := errors.Status(cause); ok {
+			return st, true
+		}
+		return status.New(codes.InvalidArgument, cause.Error()), true
+	}
+	return status.New(codes.Unknown, err.Error()), false
+}
+
+// bindingCause returns the cause of bind.DecodeError or bind.ValidationError
+// found in the error chain. Their Cause methods have pointer receivers, so
+// the errors returned by value are not unwrapped by errors.Status.
+func bindingCause(err error) error {
+	var decodeErr bind.DecodeError
+	if errors.As(err, &decodeErr) {
+		return decodeErr.Cause()
+	}
+	var validationErr bind.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Cause()
+	}
+	return nil
+}
+
+// NewErrorBody prepares error response for the request. Messages of errors
+// without gRPC status are not exposed to clients.
+func NewErrorBody(r *http.Request, err error) *ErrorBody {
+	st, ok := Status(err)
+	if !ok {
+		st = status.New(codes.Internal, "internal server error")
+	}
+	httpStatus := errorHTTPStatus(err)
+	if httpStatus == 0 {
+		httpStatus = HTTPStatus(st.Code())
+	}
+	res := &ErrorBody{
+		Type:     "about:blank",
+		Title:    http.StatusText(httpStatus),
+		Status:   httpStatus,
+		Detail:   st.Message(),
+		Instance: r.URL.Path,
+		Code:     code.Code_name[int32(st.Code())],
+		TraceID:  trace.FromContext(r.Context()).SpanContext().TraceID.String(),
+	}
+	res.retryAfter, _ = errors.RetryAfter(st)
+	for _, d := range st.Proto().GetDetails() {
+		data, err := defaultCodec(false).Encode(d)
+		if err != nil {
+			continue
+		}
+		res.Details = append(res.Details, data)
+	}
+	return res
+}
+
+// errorHTTPStatus returns HTTP status set with errors.Error.WithHTTPStatus on the
+// error that carries gRPC status or zero
+func errorHTTPStatus(err error) int {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if _, ok := e.(interface{ GRPCStatus() *status.Status }); ok {
+			if x, ok := e.(interface{ HTTPStatus() int }); ok {
+				return x.HTTPStatus()
+			}
+			return 0
+		}
+	}
+	if cause := bindingCause(err); cause != nil {
+		return errorHTTPStatus(cause)
+	}
+	return 0
+}
+
+func logError(r *http.Request, err error) {
+	st, ok := Status(err)
+	switch {
+	case !ok:
+		log.Get(r.Context()).Errorf("error: %+v", err)
+	case errors.Detailed(err, st):
+		log.Get(r.Context()).Infof("%v: %+v", st.Code(), err)
+	}
+}
+
+func errorContentType(r *http.Request) string {
+	if strings.Contains(r.Header.Get("Accept"), ProblemContentType) {
+		return ProblemContentType
+	}
+	return ErrorContentType
+}
+
+// RenderError writes error response to w. Errors without gRPC status are
+// logged and rendered as internal server errors.
+func RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	logError(r, err)
+	writeError(w, r, NewErrorBody(r, err))
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, body *ErrorBody) {
+	data, _ := json.Marshal(body)
+	w.Header().Set("Content-Type", errorContentType(r))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if body.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(body.retryAfter.Seconds()))))
+	}
+	w.WriteHeader(body.Status)
+	_, _ = w.Write(data)
+}
+
+// YieldError passes error response to Render middleware
+func YieldError(r *http.Request, err error) {
+	logError(r, err)
+	body := NewErrorBody(r, err)
+	render.Yield(r, body.Status, body)
+}
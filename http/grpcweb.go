@@ -0,0 +1,359 @@
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/go-mixins/microservice/errors"
+	pbjson "github.com/go-mixins/microservice/json"
+)
+
+// Content types of gRPC-Web requests
+const (
+	ContentTypeGRPCWeb     = "application/grpc-web"
+	ContentTypeGRPCWebText = "application/grpc-web-text"
+)
+
+const grpcTrailerFlag = 0x80
+
+var grpcExposedHeaders = []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"}
+
+// WithGRPCWeb обвязывает http.Handler для обработки запросов gRPC-Web и
+// унарных запросов протокола Connect к методам server. Запросы
+// транслируются в вызовы server, включая все его перехватчики. Остальные
+// запросы передаются src. Кросс-доменные запросы разрешаются WithCORS.
+func WithGRPCWeb(src http.Handler, server *grpc.Server) http.Handler {
+	methods := make(map[string]bool)
+	for svc, info := range server.GetServiceInfo() {
+		for _, m := range info.Methods {
+			methods["/"+svc+"/"+m.Name] = true
+		}
+	}
+	h := &grpcWebHandler{server: server}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.Header.Get("Content-Type"), ContentTypeGRPCWeb):
+			h.serveGRPCWeb(w, r)
+		case !methods[r.URL.Path]:
+			src.ServeHTTP(w, r)
+		case r.Method == http.MethodPost && connectSubtype(r) != "":
+			h.serveConnect(w, r)
+		default:
+			src.ServeHTTP(w, r)
+		}
+	})
+}
+
+type grpcWebHandler struct {
+	server *grpc.Server
+}
+
+// exposeHeaders lets browsers read gRPC status and response headers of
+// cross-origin calls allowed by WithCORS
+func exposeHeaders(w http.ResponseWriter, exposed []string) {
+	hdr := w.Header()
+	if hdr.Get("Access-Control-Allow-Origin") == "" {
+		return
+	}
+	hdr.Add("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+}
+
+// grpcRequest converts request to the form accepted by grpc.Server.ServeHTTP
+func grpcRequest(r *http.Request, contentType string, body io.Reader) *http.Request {
+	res := r.Clone(r.Context())
+	res.Proto, res.ProtoMajor, res.ProtoMinor = "HTTP/2", 2, 0
+	res.Header.Set("Content-Type", contentType)
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Body = ioutil.NopCloser(body)
+	return res
+}
+
+func (h *grpcWebHandler) serveGRPCWeb(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	text := strings.HasPrefix(contentType, ContentTypeGRPCWebText)
+	prefix := ContentTypeGRPCWeb
+	var body io.Reader = r.Body
+	if text {
+		prefix = ContentTypeGRPCWebText
+		body = base64.NewDecoder(base64.StdEncoding, r.Body)
+	}
+	subtype := strings.TrimPrefix(contentType, prefix)
+	if i := strings.IndexByte(subtype, ';'); i >= 0 {
+		subtype = subtype[:i]
+	}
+	ww := &grpcWebWriter{
+		w:           w,
+		header:      make(http.Header),
+		contentType: prefix + subtype,
+		text:        text,
+	}
+	h.server.ServeHTTP(ww, grpcRequest(r, "application/grpc"+subtype, body))
+	ww.finish()
+}
+
+// grpcWebWriter translates gRPC response to gRPC-Web, sending trailers as
+// the last frame of response body
+type grpcWebWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	contentType string
+	text        bool
+	enc         io.WriteCloser
+	wroteHeader bool
+}
+
+func (w *grpcWebWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *grpcWebWriter) isTrailer(k string) bool {
+	if strings.HasPrefix(k, http.TrailerPrefix) {
+		return true
+	}
+	for _, t := range w.header.Values("Trailer") {
+		if strings.EqualFold(t, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *grpcWebWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	dest := w.w.Header()
+	exposed := append([]string(nil), grpcExposedHeaders...)
+	for k, vv := range w.header {
+		if len(vv) == 0 || k == "Trailer" || k == "Content-Type" || w.isTrailer(k) {
+			continue
+		}
+		dest[k] = vv
+		exposed = append(exposed, k)
+	}
+	dest.Set("Content-Type", w.contentType)
+	exposeHeaders(w.w, exposed)
+	w.w.WriteHeader(code)
+}
+
+func (w *grpcWebWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.text {
+		return w.w.Write(data)
+	}
+	if w.enc == nil {
+		w.enc = base64.NewEncoder(base64.StdEncoding, w.w)
+	}
+	return w.enc.Write(data)
+}
+
+func (w *grpcWebWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.enc != nil {
+		_ = w.enc.Close()
+		w.enc = nil
+	}
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *grpcWebWriter) finish() {
+	trailers := make(http.Header)
+	for k, vv := range w.header {
+		switch {
+		case strings.HasPrefix(k, http.TrailerPrefix):
+			trailers[strings.TrimPrefix(k, http.TrailerPrefix)] = vv
+		case k != "Trailer" && w.isTrailer(k):
+			trailers[k] = vv
+		}
+	}
+	buf := new(bytes.Buffer)
+	keys := make([]string, 0, len(trailers))
+	for k := range trailers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range trailers[k] {
+			fmt.Fprintf(buf, "%s: %s\r\n", strings.ToLower(k), v)
+		}
+	}
+	frame := make([]byte, 5, 5+buf.Len())
+	frame[0] = grpcTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(buf.Len()))
+	_, _ = w.Write(append(frame, buf.Bytes()...))
+	w.Flush()
+}
+
+// connectSubtype returns codec name for Connect unary request or empty
+// string if Content-Type is not supported
+func connectSubtype(r *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/proto":
+		return "proto"
+	case "application/json":
+		return pbjson.GRPCCodecName
+	}
+	return ""
+}
+
+// bufferWriter collects gRPC response of unary call
+type bufferWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	code   int
+}
+
+func (w *bufferWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *bufferWriter) Flush() {}
+
+// ConnectError is the JSON representation of Connect protocol errors
+type ConnectError struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message,omitempty"`
+	Details []ConnectDetail `json:"details,omitempty"`
+}
+
+// ConnectDetail is the error detail in Connect protocol
+type ConnectDetail struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func (h *grpcWebHandler) serveConnect(w http.ResponseWriter, r *http.Request) {
+	subtype := connectSubtype(r)
+	// compressed requests are expected to be decoded by WithCompression
+	for _, name := range []string{"Content-Encoding", "Connect-Content-Encoding"} {
+		if enc := r.Header.Get(name); enc != "" && !strings.EqualFold(enc, "identity") {
+			writeConnectError(w, r, codes.Unimplemented, fmt.Sprintf("unsupported %s %q", name, enc), nil)
+			return
+		}
+	}
+	var reqBody io.Reader = r.Body
+	if MaxBodySize > 0 {
+		reqBody = &limitedBody{r.Body, MaxBodySize}
+	}
+	body, err := ioutil.ReadAll(reqBody)
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		writeConnectErrorStatus(w, ErrBodyTooLarge.HTTPStatus(), ErrBodyTooLarge.Code(), ErrBodyTooLarge.Error(), nil)
+		return
+	case err != nil:
+		writeConnectError(w, r, codes.InvalidArgument, "read request body: "+err.Error(), nil)
+		return
+	}
+	framed := make([]byte, 5, 5+len(body))
+	binary.BigEndian.PutUint32(framed[1:], uint32(len(body)))
+	req := grpcRequest(r, "application/grpc+"+subtype, bytes.NewReader(append(framed, body...)))
+	if ms := r.Header.Get("Connect-Timeout-Ms"); ms != "" && len(ms) <= 8 {
+		req.Header.Set("Grpc-Timeout", ms+"m")
+	}
+	rec := &bufferWriter{header: make(http.Header)}
+	h.server.ServeHTTP(rec, req)
+	for k, vv := range rec.header {
+		switch {
+		case len(vv) == 0 || k == "Content-Type" || k == "Trailer" || strings.HasPrefix(k, "Grpc-"):
+		case strings.HasPrefix(k, http.TrailerPrefix):
+			w.Header()["Trailer-"+http.CanonicalHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))] = vv
+		default:
+			w.Header()[k] = vv
+		}
+	}
+	grpcStatus := rec.header.Get("Grpc-Status")
+	if grpcStatus == "" {
+		writeConnectError(w, r, codes.Unknown, strings.TrimSpace(rec.body.String()), nil)
+		return
+	}
+	if c, _ := strconv.Atoi(grpcStatus); c != int(codes.OK) {
+		msg, _ := url.PathUnescape(rec.header.Get("Grpc-Message"))
+		writeConnectError(w, r, codes.Code(c), msg, statusDetails(rec.header.Get("Grpc-Status-Details-Bin")))
+		return
+	}
+	data := rec.body.Bytes()
+	if len(data) < 5 || len(data) < 5+int(binary.BigEndian.Uint32(data[1:5])) {
+		writeConnectError(w, r, codes.Internal, "malformed response", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/"+subtype)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data[5 : 5+binary.BigEndian.Uint32(data[1:5])])
+}
+
+func statusDetails(bin string) []ConnectDetail {
+	if bin == "" {
+		return nil
+	}
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(bin, "="))
+	if err != nil {
+		return nil
+	}
+	st := new(spb.Status)
+	if err := proto.Unmarshal(data, st); err != nil {
+		return nil
+	}
+	res := make([]ConnectDetail, 0, len(st.GetDetails()))
+	for _, d := range st.GetDetails() {
+		typeURL := d.GetTypeUrl()
+		if i := strings.LastIndexByte(typeURL, '/'); i >= 0 {
+			typeURL = typeURL[i+1:]
+		}
+		res = append(res, ConnectDetail{
+			Type:  typeURL,
+			Value: base64.RawStdEncoding.EncodeToString(d.GetValue()),
+		})
+	}
+	return res
+}
+
+func writeConnectError(w http.ResponseWriter, r *http.Request, c codes.Code, msg string, details []ConnectDetail) {
+	writeConnectErrorStatus(w, HTTPStatus(c), c, msg, details)
+}
+
+func writeConnectErrorStatus(w http.ResponseWriter, httpStatus int, c codes.Code, msg string, details []ConnectDetail) {
+	data, _ := json.Marshal(ConnectError{
+		Code:    strings.ToLower(code.Code_name[int32(c)]),
+		Message: msg,
+		Details: details,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	_, _ = w.Write(data)
+}
@@ -4,16 +4,20 @@ import (
 	"net/http"
 	"runtime/debug"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/go-mixins/log"
+	"github.com/go-mixins/microservice/metrics"
+	"github.com/go-mixins/microservice/requestid"
 	"gocloud.dev/server/health"
 
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
 	"go.opencensus.io/trace"
 	"go.opencensus.io/zpages"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Checker служит для подключения внешних проверок на живость
@@ -69,66 +73,179 @@ func WithTracing(src http.Handler) http.Handler {
 	}
 }
 
-// clientIP implements a best effort algorithm to return the real client IP, it parses
-// X-Real-IP and X-Forwarded-For in order to work properly with reverse-proxies such us: nginx or haproxy.
-// This is almost unmodified code from Gin framework and all credits and my deepest thanks go to Gin developers.
-func clientIP(r *http.Request) string {
-	clientIP := strings.TrimSpace(r.Header.Get("X-Real-Ip"))
-	if len(clientIP) > 0 {
-		return clientIP
+// serverViews are ochttp.DefaultServerViews with latency tagged by route
+var serverViews = func() []*view.View {
+	latency := *ochttp.ServerLatencyView
+	latency.TagKeys = append(append([]tag.Key(nil), latency.TagKeys...), ochttp.KeyServerRoute)
+	res := make([]*view.View, len(ochttp.DefaultServerViews))
+	for i, v := range ochttp.DefaultServerViews {
+		if v == ochttp.ServerLatencyView {
+			v = &latency
+		}
+		res[i] = v
 	}
-	clientIP = r.Header.Get("X-Forwarded-For")
-	if index := strings.IndexByte(clientIP, ','); index >= 0 {
-		clientIP = clientIP[0:index]
+	return res
+}()
+
+// LogOption настраивает WithLog
+type LogOption func(*logOptions)
+
+type logOptions struct {
+	routes RouteResolver
+	prefix string
+	levels [6]LogLevel
+}
+
+// LogLevel задает уровень записи в журнал доступа
+type LogLevel int
+
+// Уровни журнала доступа
+const (
+	DebugLevel LogLevel = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+func (l LogLevel) logf(logger log.ContextLogger, format string, args ...interface{}) {
+	switch l {
+	case InfoLevel:
+		logger.Infof(format, args...)
+	case WarnLevel:
+		logger.Warnf(format, args...)
+	case ErrorLevel:
+		logger.Errorf(format, args...)
+	default:
+		logger.Debugf(format, args...)
 	}
-	clientIP = strings.TrimSpace(clientIP)
-	if len(clientIP) > 0 {
-		return clientIP
+}
+
+// LogStatusLevel задает уровень журнала доступа для класса кодов ответа
+// (1 для 1xx, 2 для 2xx и т.д.)
+func LogStatusLevel(class int, level LogLevel) LogOption {
+	return func(opts *logOptions) {
+		if class > 0 && class < len(opts.levels) {
+			opts.levels[class] = level
+		}
 	}
-	return strings.TrimSpace(r.RemoteAddr)
 }
 
-var httpOnce sync.Once
+func (opts *logOptions) level(status int) LogLevel {
+	if class := status / 100; class > 0 && class < len(opts.levels) {
+		return opts.levels[class]
+	}
+	return DebugLevel
+}
 
-// WithLog обвязывает http.Handler для логирования запросов
-func WithLog(src http.Handler, logger log.ContextLogger) http.Handler {
-	httpOnce.Do(func() {
-		ochttp.ServerLatencyView.TagKeys = append(ochttp.ServerLatencyView.TagKeys, ochttp.KeyServerRoute)
-		if err := view.Register(ochttp.DefaultServerViews...); err != nil {
-			logger.Errorf("registering HTTP views: %+v", err)
+// LogRoutes задает RouteResolver для меток метрик и поля http_route
+func LogRoutes(resolver RouteResolver) LogOption {
+	return func(opts *logOptions) {
+		opts.routes = resolver
+	}
+}
+
+func (opts *logOptions) route(r *http.Request) string {
+	if opts.routes != nil {
+		if route := opts.routes.Route(r); route != "" {
+			return route
 		}
-	})
+	}
+	return DefaultRouteResolver.Route(r)
+}
+
+// LogPrefix задает префикс пути, установленный WithPrefix внутри WithLog.
+// Служебные пути /metrics, /healthz и /debug не логируются и под префиксом.
+func LogPrefix(prefix string) LogOption {
+	return func(opts *logOptions) {
+		if prefix = strings.Trim(prefix, "/"); prefix != "" {
+			opts.prefix = "/" + prefix
+		}
+	}
+}
+
+// skip reports whether the request is made to a service endpoint that is not
+// logged
+func (opts *logOptions) skip(r *http.Request) bool {
+	p := r.URL.Path
+	if opts.prefix != "" {
+		p, _ = trimPrefix(p, opts.prefix)
+	}
+	for _, s := range []string{"/metrics", "/healthz", "/debug"} {
+		if strings.HasPrefix(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithLog обвязывает http.Handler для логирования запросов
+func WithLog(src http.Handler, logger log.ContextLogger, options ...LogOption) http.Handler {
+	if err := metrics.Register(serverViews...); err != nil {
+		logger.Errorf("registering HTTP views: %+v", err)
+	}
+	var opts logOptions
+	opts.levels[5] = WarnLevel
+	for _, o := range options {
+		o(&opts)
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		route := r.URL.Path
-		switch {
-		case strings.HasPrefix(r.URL.Path, "/metrics"):
-			fallthrough
-		case strings.HasPrefix(r.URL.Path, "/healthz"):
-			fallthrough
-		case strings.HasPrefix(r.URL.Path, "/debug"):
+		if opts.skip(r) {
 			src.ServeHTTP(w, r)
 			return
 		}
 		ts := NowFunc()
 		ctx := r.Context()
 		traceID := trace.FromContext(ctx).SpanContext().TraceID.String()
+		route := opts.route(r)
+		initialRoute := route
 		ochttp.SetRoute(ctx, route)
 		logger := logger.WithContext(log.M{
 			"http_route": route,
 			"client_ip":  clientIP(r),
 			"trace_id":   traceID,
+			"request_id": requestid.From(ctx),
 		})
-		ctx = log.With(ctx, logger)
+		ctx = log.With(withRoute(ctx, &route), logger)
+		r = r.WithContext(ctx)
+		sw := newStatusWriter(w)
 		defer func() {
+			if route != initialRoute {
+				logger = logger.WithContext(log.M{"http_route": route})
+			}
+			entry := log.M{
+				"result": "success",
+			}
+			// the response can't be replaced once its header is sent, so the
+			// connection is aborted instead
+			abort := false
 			if err := recover(); err != nil {
-				http.Error(w, "internal server error", 500)
+				entry["result"] = "panic"
+				if sw.status == 0 && !sw.hijacked && err != http.ErrAbortHandler {
+					writeError(sw, r, NewErrorBody(r, status.Error(codes.Internal, "internal server error")))
+				} else {
+					abort = true
+				}
 				logger.Errorf("%+v", err)
 				logger.Debugf("panic trace: %s", debug.Stack())
-				return
 			}
-			logger.Debugf("finished request in %v", NowFunc().Sub(ts))
+			code := sw.Status()
+			if code >= 400 && entry["result"] == "success" {
+				entry["result"] = "error"
+			}
+			elapsed := NowFunc().Sub(ts)
+			entry["code"] = code
+			entry["method"] = r.Method
+			entry["url"] = r.URL.RequestURI()
+			entry["proto"] = r.Proto
+			entry["user_agent"] = r.UserAgent()
+			entry["bytes"] = sw.bytes
+			entry["duration_ms"] = float64(elapsed) / float64(time.Millisecond)
+			opts.level(code).logf(logger.WithContext(entry), "finished request in %v", elapsed)
+			if abort {
+				panic(http.ErrAbortHandler)
+			}
 		}()
 		w.Header().Set("X-Trace-ID", traceID)
-		src.ServeHTTP(w, r.WithContext(ctx))
+		src.ServeHTTP(exposeCapabilities(sw, w), r)
 	})
 }
@@ -0,0 +1,44 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-mixins/log"
+)
+
+func TestLogSkip(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		options []LogOption
+		path    string
+		logged  bool
+	}{
+		{"request", nil, "/api", true},
+		{"metrics", nil, "/metrics", false},
+		{"readiness", nil, "/healthz/readiness", false},
+		{"zpages", nil, "/debug/tracez", false},
+		{"under prefix", []LogOption{LogPrefix("/svc/")}, "/svc/api", true},
+		{"metrics under prefix", []LogOption{LogPrefix("/svc/")}, "/svc/metrics", false},
+		{"readiness under prefix", []LogOption{LogPrefix("/svc/")}, "/svc/healthz/readiness", false},
+		{"root metrics with prefix", []LogOption{LogPrefix("/svc/")}, "/metrics", false},
+		{"empty prefix", []LogOption{LogPrefix("")}, "/metrics", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &debugLogger{ContextLogger: log.Get(context.Background())}
+			called := false
+			h := WithLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}), logger, tc.options...)
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tc.path, nil))
+			if !called {
+				t.Error("handler is not called")
+			}
+			if logged := len(logger.lines) > 0; logged != tc.logged {
+				t.Errorf("expected request to be logged: %v, got %q", tc.logged, logger.lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-mixins/log"
+
+	"github.com/go-mixins/microservice/idempotency"
+)
+
+// WithIdempotency обвязывает http.Handler для повторной отдачи сохранённого
+// ответа на запросы с тем же заголовком Idempotency-Key. Ключи привязаны к
+// вызывающему через scope, поэтому обвязка устанавливается после
+// аутентификации. Если scope не задан, ключи общие для всех клиентов.
+// Повторное использование ключа с другим запросом отклоняется с кодом 422.
+// Ответы 5xx и ответы больше idempotency.MaxResponseSize не сохраняются,
+// чтобы клиент мог повторить запрос.
+func WithIdempotency(src http.Handler, store idempotency.Store, scope idempotency.Scope) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotency.Header)
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			key = ""
+		}
+		if key == "" {
+			src.ServeHTTP(w, r)
+			return
+		}
+		if !idempotency.ValidKey(key) {
+			RenderError(w, r, idempotency.ErrInvalidKey)
+			return
+		}
+		ctx := r.Context()
+		var caller string
+		if scope != nil {
+			if caller = scope(ctx); caller == "" {
+				src.ServeHTTP(w, r)
+				return
+			}
+		}
+		hash, err := requestHash(w, r)
+		if err != nil {
+			RenderError(w, r, err)
+			return
+		}
+		key = strings.Join([]string{caller, r.Method, r.URL.Path, key}, "\n")
+		res, err := store.Begin(ctx, key)
+		if err != nil {
+			RenderError(w, r, err)
+			return
+		}
+		if res != nil {
+			if res.RequestHash != hash {
+				RenderError(w, r, idempotency.ErrKeyReused)
+				return
+			}
+			hdr := w.Header()
+			for k, vv := range res.Header {
+				hdr[k] = append([]string(nil), vv...)
+			}
+			hdr.Set(idempotency.ReplayedHeader, "true")
+			w.WriteHeader(res.Status)
+			_, _ = w.Write(res.Body)
+			return
+		}
+		before := w.Header().Clone()
+		cw := &captureWriter{statusWriter: newStatusWriter(w), limit: idempotency.MaxResponseSize}
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := store.Release(ctx, key); err != nil {
+				log.Get(ctx).Warnf("releasing idempotency key: %+v", err)
+			}
+		}()
+		src.ServeHTTP(exposeCapabilities(cw, w), r)
+		if cw.hijacked || cw.truncated || cw.Status() >= http.StatusInternalServerError {
+			return
+		}
+		res = &idempotency.Response{
+			Status:      cw.Status(),
+			Header:      headerDiff(before, cw.Header()),
+			Body:        cw.body.Bytes(),
+			RequestHash: hash,
+		}
+		if err := store.Complete(ctx, key, res); err != nil {
+			log.Get(ctx).Warnf("storing idempotent response: %+v", err)
+			return
+		}
+		completed = true
+	})
+}
+
+// requestHash reads request body, limited by MaxBodySize, and returns hash
+// of the body together with query and content type
+func requestHash(w http.ResponseWriter, r *http.Request) (string, error) {
+	body := r.Body
+	if MaxBodySize > 0 {
+		body = http.MaxBytesReader(w, body, MaxBodySize)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", decodeError(err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(data))
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", r.URL.RawQuery, r.Header.Get("Content-Type"))
+	h.Write(data)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// headerDiff returns header fields set by the handler, leaving out those set
+// by outer middleware for the current request only
+func headerDiff(before, after http.Header) http.Header {
+	res := make(http.Header)
+	for k, vv := range after {
+		if strings.Join(before[k], ",") != strings.Join(vv, ",") {
+			res[k] = append([]string(nil), vv...)
+		}
+	}
+	return res
+}
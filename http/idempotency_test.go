@@ -0,0 +1,141 @@
+package http
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-mixins/microservice/idempotency"
+)
+
+type callerKey struct{}
+
+func idempotencyRequest(h http.Handler, method, key, caller, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/items?x=1", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		r.Header.Set(idempotency.Header, key)
+	}
+	if caller != "" {
+		r = r.WithContext(context.WithValue(r.Context(), callerKey{}, caller))
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotency(t *testing.T) {
+	store := idempotency.NewMemoryStore(idempotency.Config{Size: 10, TTL: time.Hour})
+	scope := func(ctx context.Context) string {
+		caller, _ := ctx.Value(callerKey{}).(string)
+		return caller
+	}
+	calls := 0
+	h := WithIdempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		data, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Location", "/items/"+string(data))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"id":"`+string(data)+`"}`)
+	}), store, scope)
+	for _, tc := range []struct {
+		name     string
+		method   string
+		key      string
+		caller   string
+		body     string
+		status   int
+		replayed bool
+		calls    int
+	}{
+		{"first call", "POST", "k1", "alice", "a", http.StatusCreated, false, 1},
+		{"replay", "POST", "k1", "alice", "a", http.StatusCreated, true, 1},
+		{"other method", "PUT", "k1", "alice", "a", http.StatusCreated, false, 2},
+		{"reused key", "POST", "k1", "alice", "b", http.StatusUnprocessableEntity, false, 2},
+		{"other caller", "POST", "k1", "bob", "b", http.StatusCreated, false, 3},
+		{"other key", "POST", "k2", "alice", "a", http.StatusCreated, false, 4},
+		{"no key", "POST", "", "alice", "a", http.StatusCreated, false, 5},
+		{"no key again", "POST", "", "alice", "a", http.StatusCreated, false, 6},
+		{"no caller", "POST", "k1", "", "a", http.StatusCreated, false, 7},
+		{"safe method", "GET", "k1", "alice", "", http.StatusCreated, false, 8},
+		{"invalid key", "POST", "a b", "alice", "a", http.StatusBadRequest, false, 8},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := idempotencyRequest(h, tc.method, tc.key, tc.caller, tc.body)
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+			if replayed := w.Header().Get(idempotency.ReplayedHeader) == "true"; replayed != tc.replayed {
+				t.Errorf("expected replayed %v", tc.replayed)
+			}
+			if calls != tc.calls {
+				t.Errorf("expected %d handler calls, got %d", tc.calls, calls)
+			}
+			if tc.status == http.StatusCreated {
+				if loc := w.Header().Get("Location"); loc != "/items/"+tc.body {
+					t.Errorf("unexpected Location %q", loc)
+				}
+				if body := w.Body.String(); body != `{"id":"`+tc.body+`"}` {
+					t.Errorf("unexpected body %q", body)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	store := idempotency.NewMemoryStore(idempotency.Config{Size: 1, TTL: time.Hour})
+	var h http.Handler
+	var inner []int
+	h = WithIdempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the same key is in progress and the store is full of reservations
+		inner = append(inner,
+			idempotencyRequest(h, "POST", "k1", "", "a").Code,
+			idempotencyRequest(h, "POST", "k2", "", "a").Code,
+		)
+		w.WriteHeader(http.StatusNoContent)
+	}), store, nil)
+	if w := idempotencyRequest(h, "POST", "k1", "", "a"); w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	if len(inner) != 2 || inner[0] != http.StatusConflict || inner[1] != http.StatusTooManyRequests {
+		t.Errorf("expected 409 and 429 for concurrent calls, got %v", inner)
+	}
+}
+
+func TestIdempotencyNotStored(t *testing.T) {
+	defer func(size int) { idempotency.MaxResponseSize = size }(idempotency.MaxResponseSize)
+	idempotency.MaxResponseSize = 8
+	for _, tc := range []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"server error", http.StatusServiceUnavailable, "retry"},
+		{"large response", http.StatusOK, "too large response"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := idempotency.NewMemoryStore(idempotency.Config{Size: 10, TTL: time.Hour})
+			calls := 0
+			h := WithIdempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(tc.status)
+				_, _ = io.WriteString(w, tc.body)
+			}), store, nil)
+			for i := 0; i < 2; i++ {
+				w := idempotencyRequest(h, "POST", "k1", "", "a")
+				if w.Code != tc.status || w.Body.String() != tc.body {
+					t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+				}
+			}
+			if calls != 2 {
+				t.Errorf("expected the call to be repeated, got %d calls", calls)
+			}
+		})
+	}
+}
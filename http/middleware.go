@@ -2,96 +2,148 @@ package http
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
+	"strings"
 
 	"github.com/go-mixins/log"
+	pbjson "github.com/go-mixins/microservice/json"
+	"github.com/go-mixins/microservice/redact"
+	"github.com/go-mixins/microservice/validate"
 	"golang.org/x/net/html/charset"
 	"golang.org/x/text/encoding/charmap"
-	jsonpb "google.golang.org/protobuf/encoding/protojson"
-	"google.golang.org/protobuf/proto"
 
 	"github.com/go-noodle/bind"
 	"github.com/go-noodle/noodle"
-	"github.com/go-noodle/render"
 )
 
-var marshaler = &jsonpb.MarshalOptions{
-	Multiline:       true,
-	Indent:          "\t",
-	EmitUnpopulated: true,
-	UseProtoNames:   true,
+// Debug incoming HTTP requests and outgoing responses with default redaction
+// rules. redact.Default is read on each request, so rules loaded from the
+// environment after the middleware is created are applied as well.
+func Debug() noodle.Middleware {
+	return debugWith(func() redact.Rules { return redact.Default })
 }
 
-// Debug incoming HTTP requests
-func Debug() noodle.Middleware {
+// DebugWith logs incoming HTTP requests and outgoing responses, hiding
+// sensitive headers and body fields according to the rules. At most
+// rules.MaxSize bytes of each body plus a margin for redaction are kept in
+// memory, the rest is streamed through.
+func DebugWith(rules redact.Rules) noodle.Middleware {
+	return debugWith(func() redact.Rules { return rules })
+}
+
+func debugWith(getRules func() redact.Rules) noodle.Middleware {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			data, _ := httputil.DumpRequest(r, true)
-			if enc, _, ok := charset.DetermineEncoding(data, r.Header.Get("Content-Type")); ok {
-				if decoded, err := enc.NewDecoder().Bytes(data); err == nil {
-					data = decoded
-				}
-			} else if bytes.Contains(data, []byte("windows-1251")) {
-				data, _ = charmap.Windows1251.NewDecoder().Bytes(data)
+			rules := getRules()
+			limit := 0
+			if rules.MaxSize > 0 {
+				limit = rules.MaxSize + debugRedactMargin
+			}
+			logger := log.Get(r.Context())
+			var body []byte
+			if limit > 0 {
+				body, _ = ioutil.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+			} else {
+				body, _ = ioutil.ReadAll(r.Body)
 			}
-			if len(data) > 4096 {
-				data = append(data[:4096], []byte("...")...)
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			complete := limit == 0 || len(body) <= limit
+			if !complete {
+				body = body[:limit]
 			}
-			log.Get(r.Context()).Debugf("received request: %s", data)
-			next(w, r)
+			dump := *r
+			dump.Header = rules.Header(r.Header)
+			head, _ := httputil.DumpRequest(&dump, false)
+			logger.Debugf("received request: %s%s", head, debugBody(rules, body, complete, r.Header.Get("Content-Type")))
+			cw := &captureWriter{statusWriter: newStatusWriter(w), limit: limit}
+			next(exposeCapabilities(cw, w), r)
+			data := debugBody(rules, cw.body.Bytes(), !cw.truncated, cw.Header().Get("Content-Type"))
+			logger.Debugf("sent response: %d %s\n%s\n%s", cw.Status(), http.StatusText(cw.Status()), formatHeader(rules.Header(cw.Header())), data)
 		}
 	}
 }
 
-// Render extends noodle's render middleware with JSONPB support
-func Render() noodle.Middleware {
-	return render.Generic(func(w io.Writer, dest interface{}) error {
-		if dest == nil {
-			return nil
-		}
-		if pb, ok := dest.(proto.Message); ok {
-			res, err := marshaler.Marshal(pb)
-			if err != nil {
-				return err
-			}
-			if _, err := w.Write(res); err != nil {
-				return err
-			}
+// debugRedactMargin is captured in addition to MaxSize, so that redaction
+// could be applied to bodies slightly larger than the logged part
+const debugRedactMargin = 64 << 10
+
+// debugBody redacts and truncates body for logging. Incomplete JSON can not
+// be redacted, so only its size is logged.
+func debugBody(rules redact.Rules, data []byte, complete bool, contentType string) []byte {
+	if !complete && strings.Contains(contentType, "json") {
+		return []byte(fmt.Sprintf("[%d+ bytes of %s]", len(data), contentType))
+	}
+	return rules.Truncate(rules.Body(decodeCharset(data, contentType), contentType))
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func decodeCharset(data []byte, contentType string) []byte {
+	if enc, _, ok := charset.DetermineEncoding(data, contentType); ok {
+		if decoded, err := enc.NewDecoder().Bytes(data); err == nil {
+			return decoded
 		}
-		return json.NewEncoder(w).Encode(dest)
-	}, "application/json")
+	} else if bytes.Contains(data, []byte("windows-1251")) {
+		data, _ = charmap.Windows1251.NewDecoder().Bytes(data)
+	}
+	return data
 }
 
-var unmarshaler = &jsonpb.UnmarshalOptions{
-	DiscardUnknown: true,
+func formatHeader(h http.Header) []byte {
+	buf := new(bytes.Buffer)
+	_ = h.Write(buf)
+	return buf.Bytes()
 }
 
-type decoder struct {
-	r io.Reader
+// captureWriter keeps a copy of response body up to the limit while passing
+// it through. Zero limit captures the body entirely.
+type captureWriter struct {
+	*statusWriter
+	body      bytes.Buffer
+	limit     int
+	truncated bool
 }
 
-func (d decoder) Decode(dest interface{}) (rErr error) {
-	if pb, ok := dest.(proto.Message); ok {
-		data, err := ioutil.ReadAll(d.r)
+func (w *captureWriter) Write(data []byte) (int, error) {
+	capture := data
+	if w.limit > 0 && w.body.Len()+len(capture) > w.limit {
+		capture = capture[:w.limit-w.body.Len()]
+		w.truncated = true
+	}
+	w.body.Write(capture)
+	return w.statusWriter.Write(data)
+}
+
+// Validate returns binding option that checks decoded data with
+// validate.Check. Invalid data results in InvalidArgument error with field
+// violations rendered as 400 by RenderError.
+func Validate() bind.Option {
+	return func(val interface{}, err error) error {
 		if err != nil {
 			return err
 		}
-		return fmt.Errorf("decode jsonpb: %w", unmarshaler.Unmarshal(data, pb))
+		return validate.Check(val)
 	}
-	return fmt.Errorf("decode json: %w", json.NewDecoder(d.r).Decode(dest))
-}
-
-func jsonPB(r *http.Request) bind.Decoder {
-	return decoder{r.Body}
 }
 
 // JSON returns middleware constructor that allows binding of
-// proto.Messages and generic objects from request body
+// proto.Messages and generic objects from request body. Body format is
+// selected by Content-Type: JSON (default), binary protobuf, URL-encoded or
+// multipart form. Decoded data is validated before other options are
+// applied.
 func JSON(model interface{}, opts ...bind.Option) noodle.Middleware {
-	return bind.Generic(model, jsonPB, opts...)
+	return JSONCodec(nil, model, opts...)
+}
+
+// JSONCodec is JSON with specified codec for JSON and form bodies. Default
+// codec is used if codec is nil.
+func JSONCodec(codec *pbjson.Codec, model interface{}, opts ...bind.Option) noodle.Middleware {
+	return bind.Generic(model, newDecoder(codec), append([]bind.Option{Validate()}, opts...)...)
 }
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-mixins/log"
+	"github.com/go-mixins/microservice/redact"
+	"github.com/go-noodle/noodle"
+)
+
+// debugLogger records debug messages
+type debugLogger struct {
+	log.ContextLogger
+	lines []string
+}
+
+func (l *debugLogger) Debugf(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func (l *debugLogger) WithContext(log.M) log.ContextLogger {
+	return l
+}
+
+func debugRequest(t *testing.T, mw noodle.Middleware, r *http.Request, response string) (received string, logged []string) {
+	t.Helper()
+	logger := &debugLogger{ContextLogger: log.Get(context.Background())}
+	r = r.WithContext(log.With(r.Context(), logger))
+	h := mw(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		received = string(data)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		_, _ = w.Write([]byte(response))
+	})
+	h(httptest.NewRecorder(), r)
+	if len(logger.lines) != 2 {
+		t.Fatalf("expected request and response to be logged, got %q", logger.lines)
+	}
+	return received, logger.lines
+}
+
+func TestDebug(t *testing.T) {
+	rules := redact.Rules{
+		Headers: []string{"Authorization", "Set-Cookie"},
+		Fields:  []string{"password"},
+		MaxSize: 64,
+	}
+	large := `{"password":"p","data":"` + strings.Repeat("x", 64+debugRedactMargin) + `"}`
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        string
+		response    string
+		logged      []string
+		notLogged   []string
+	}{
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        `{"login":"user","password":"p4ss"}`,
+			response:    `{"token":"t0k3n","password":"p4ss"}`,
+			logged:      []string{`"login":"user"`, `"password":"[REDACTED]"`, `"token":"t0k3n"`, "Authorization: [REDACTED]", "Set-Cookie: [REDACTED]"},
+			notLogged:   []string{"p4ss", "Bearer", "session=secret"},
+		},
+		{
+			name:        "truncated",
+			contentType: "text/plain",
+			body:        strings.Repeat("a", 100),
+			response:    `{}`,
+			logged:      []string{strings.Repeat("a", 64) + "..."},
+			notLogged:   []string{strings.Repeat("a", 65)},
+		},
+		{
+			name:        "over capture limit",
+			contentType: "application/json",
+			body:        large,
+			response:    large,
+			logged:      []string{fmt.Sprintf("[%d+ bytes of application/json]", 64+debugRedactMargin)},
+			notLogged:   []string{`"password":"p"`},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+			r.Header.Set("Authorization", "Bearer secret")
+			received, lines := debugRequest(t, DebugWith(rules), r, tc.response)
+			if received != tc.body {
+				t.Errorf("handler received %d bytes instead of %d", len(received), len(tc.body))
+			}
+			logged := strings.Join(lines, "\n")
+			for _, s := range tc.logged {
+				if !strings.Contains(logged, s) {
+					t.Errorf("%q is not logged in:\n%s", s, logged)
+				}
+			}
+			for _, s := range tc.notLogged {
+				if strings.Contains(logged, s) {
+					t.Errorf("%q is logged", s)
+				}
+			}
+		})
+	}
+}
+
+func TestDebugDefaultRules(t *testing.T) {
+	mw := Debug()
+	saved := redact.Default
+	defer func() { redact.Default = saved }()
+	redact.Default.Fields = []string{"login"}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"login":"user"}`))
+	r.Header.Set("Content-Type", "application/json")
+	_, lines := debugRequest(t, mw, r, `{}`)
+	if strings.Contains(lines[0], "user") {
+		t.Errorf("rules set after creating middleware are not applied: %s", lines[0])
+	}
+}
@@ -0,0 +1,108 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type prefixKey struct{}
+
+// WithPrefix обвязывает http.Handler для обслуживания запросов под префиксом
+// пути. Префикс отрезается перед вызовом src, остальные запросы передаются root.
+// Абсолютные пути в заголовке Location ответа дополняются префиксом.
+func WithPrefix(src http.Handler, prefix string, root http.Handler) http.Handler {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		return src
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := trimPrefix(r.URL.Path, prefix)
+		if !ok {
+			root.ServeHTTP(w, r)
+			return
+		}
+		r2 := r.WithContext(context.WithValue(r.Context(), prefixKey{}, prefix))
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = p
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath, _ = trimPrefix(r.URL.RawPath, prefix)
+		}
+		src.ServeHTTP(exposeCapabilities(&prefixWriter{statusWriter: newStatusWriter(w), prefix: prefix}, w), r2)
+	})
+}
+
+// PrefixRouteResolver adapts resolver of application routes for middleware
+// installed outside of WithPrefix, resolving requests with the prefix
+// stripped. Other requests are resolved as is.
+func PrefixRouteResolver(resolver RouteResolver, prefix string) RouteResolver {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		return resolver
+	}
+	return RouteResolverFunc(func(r *http.Request) string {
+		p, ok := trimPrefix(r.URL.Path, prefix)
+		if !ok {
+			return resolver.Route(r)
+		}
+		r2 := r.WithContext(r.Context())
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path, r2.URL.RawPath = p, ""
+		return resolver.Route(r2)
+	})
+}
+
+func trimPrefix(p, prefix string) (string, bool) {
+	if p == prefix {
+		return "/", true
+	}
+	if !strings.HasPrefix(p, prefix+"/") {
+		return p, false
+	}
+	return p[len(prefix):], true
+}
+
+// Prefix returns path prefix stripped from the request by WithPrefix
+func Prefix(ctx context.Context) string {
+	prefix, _ := ctx.Value(prefixKey{}).(string)
+	return prefix
+}
+
+// Link returns absolute path of the application resource as seen by the
+// client, i.e. with the stripped prefix prepended
+func Link(r *http.Request, path string) string {
+	return addPrefix(Prefix(r.Context()), path)
+}
+
+// Redirect replies with redirect to the application path, adding the prefix
+// stripped by WithPrefix
+func Redirect(w http.ResponseWriter, r *http.Request, path string, code int) {
+	http.Redirect(w, r, Link(r, path), code)
+}
+
+func addPrefix(prefix, path string) string {
+	if prefix == "" || !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		return path
+	}
+	if _, ok := trimPrefix(path, prefix); ok {
+		return path
+	}
+	return prefix + path
+}
+
+// prefixWriter fixes Location header of redirects issued by handlers that
+// are not aware of the prefix, e.g. http.ServeMux
+type prefixWriter struct {
+	*statusWriter
+	prefix string
+}
+
+func (w *prefixWriter) WriteHeader(code int) {
+	if loc := w.Header().Get("Location"); loc != "" {
+		w.Header().Set("Location", addPrefix(w.prefix, loc))
+	}
+	w.statusWriter.WriteHeader(code)
+}
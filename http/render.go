@@ -0,0 +1,229 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-noodle/noodle"
+	"github.com/go-noodle/render"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+
+	pbjson "github.com/go-mixins/microservice/json"
+)
+
+// PrettyJSON enables indented JSON output of Render. Application sets it
+// from HTTP_PRETTY_JSON.
+var PrettyJSON = false
+
+// Codecs used by Render and JSON binding unless specified explicitly. When
+// not set, they follow json.Default: Codec is its single-line variant and
+// PrettyCodec is json.Default itself. PrettyCodec replaces Codec for output
+// when PrettyJSON is enabled.
+var (
+	Codec       *pbjson.Codec
+	PrettyCodec *pbjson.Codec
+)
+
+func defaultCodec(output bool) *pbjson.Codec {
+	if output && PrettyJSON {
+		if PrettyCodec != nil {
+			return PrettyCodec
+		}
+		return pbjson.Default
+	}
+	if Codec != nil {
+		return Codec
+	}
+	singleLine.Lock()
+	defer singleLine.Unlock()
+	if singleLine.src != pbjson.Default {
+		singleLine.src, singleLine.res = pbjson.Default, pbjson.Default.SingleLine()
+	}
+	return singleLine.res
+}
+
+// singleLine caches the single-line variant of json.Default until it is
+// replaced
+var singleLine struct {
+	sync.Mutex
+	src, res *pbjson.Codec
+}
+
+// Content types supported by Render
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeYAML     = "application/yaml"
+)
+
+var renderTypes = map[string]string{
+	"application/json":                ContentTypeJSON,
+	"application/x-protobuf":          ContentTypeProtobuf,
+	"application/protobuf":            ContentTypeProtobuf,
+	"application/vnd.google.protobuf": ContentTypeProtobuf,
+	"application/yaml":                ContentTypeYAML,
+	"application/x-yaml":              ContentTypeYAML,
+	"text/yaml":                       ContentTypeYAML,
+}
+
+// negotiate selects the supported content type with the highest quality
+// from Accept header. JSON is used by default.
+func negotiate(accept string) string {
+	res, best := ContentTypeJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if ct, ok := renderTypes[mediaType]; ok && q > best {
+			res, best = ct, q
+		}
+	}
+	return res
+}
+
+// addVary adds names to Vary header unless they are already listed
+func addVary(h http.Header, names ...string) {
+	listed := make(map[string]bool)
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			listed[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+	for _, name := range names {
+		if name = http.CanonicalHeaderKey(name); !listed[name] {
+			h.Add("Vary", name)
+			listed[name] = true
+		}
+	}
+}
+
+// renderWriter defers WriteHeader until the first Write so that serializer
+// could set the actual content type
+type renderWriter struct {
+	*statusWriter
+	contentType string
+	codec       *pbjson.Codec
+	code        int
+}
+
+func (w *renderWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *renderWriter) Write(data []byte) (int, error) {
+	w.writeHeader()
+	return w.statusWriter.Write(data)
+}
+
+func (w *renderWriter) Flush() {
+	w.writeHeader()
+	w.statusWriter.Flush()
+}
+
+func (w *renderWriter) writeHeader() {
+	if w.code != 0 && w.statusWriter.status == 0 {
+		w.statusWriter.WriteHeader(w.code)
+	}
+}
+
+func (w *renderWriter) serialize(data interface{}) error {
+	if data == nil {
+		return nil
+	}
+	pb, isProto := data.(proto.Message)
+	contentType := w.contentType
+	if contentType == ContentTypeProtobuf && !isProto {
+		contentType = ContentTypeJSON
+	}
+	var (
+		res []byte
+		err error
+	)
+	switch contentType {
+	case ContentTypeProtobuf:
+		res, err = proto.Marshal(pb)
+	case ContentTypeYAML:
+		res, err = marshalYAML(data, w.codec)
+	default:
+		res, err = marshalJSON(data, w.codec)
+	}
+	if err != nil {
+		return err
+	}
+	if contentType == ContentTypeProtobuf {
+		w.Header().Set("Content-Type", contentType)
+	} else {
+		w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	}
+	_, err = w.Write(res)
+	return err
+}
+
+func marshalJSON(data interface{}, codec *pbjson.Codec) ([]byte, error) {
+	if pb, ok := data.(proto.Message); ok {
+		return codec.Encode(pb)
+	}
+	if codec.Marshaler.Multiline {
+		return json.MarshalIndent(data, "", codec.Marshaler.Indent)
+	}
+	return json.Marshal(data)
+}
+
+func marshalYAML(data interface{}, codec *pbjson.Codec) ([]byte, error) {
+	jd, err := marshalJSON(data, codec)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal(jd, &doc); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+var renderer = render.Generic(func(w io.Writer, data interface{}) error {
+	return innerWriter(w.(http.ResponseWriter)).(*renderWriter).serialize(data)
+}, ContentTypeJSON)
+
+// Render extends noodle's render middleware with JSONPB support and
+// negotiates output format with Accept header. Supported formats are JSON,
+// YAML and binary protobuf for proto.Messages.
+func Render() noodle.Middleware {
+	return RenderCodec(nil)
+}
+
+// RenderCodec is Render with specified JSON codec. Default codecs are used
+// if codec is nil.
+func RenderCodec(codec *pbjson.Codec) noodle.Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		h := renderer(next)
+		return func(w http.ResponseWriter, r *http.Request) {
+			addVary(w.Header(), "Accept")
+			rw := &renderWriter{
+				statusWriter: newStatusWriter(w),
+				contentType:  negotiate(r.Header.Get("Accept")),
+				codec:        codec,
+			}
+			if rw.codec == nil {
+				rw.codec = defaultCodec(true)
+			}
+			h(exposeCapabilities(rw, w), r)
+			rw.writeHeader()
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package http
+
+import (
+	"net/http"
+
+	mdHTTP "github.com/go-mixins/metadata/http"
+
+	"github.com/go-mixins/microservice/requestid"
+)
+
+// WithRequestID обвязывает http.Handler для приёма или создания
+// идентификатора запроса. Идентификатор передаётся в метаданных контекста и
+// возвращается клиенту в заголовке X-Request-Id.
+func WithRequestID(src http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestid.Ensure(
+			r.Header.Get(requestid.Header),
+			r.Header.Get(mdHTTP.HeaderKeyPrefix+requestid.MetadataKey),
+		)
+		r.Header.Set(requestid.Header, id)
+		// metadata imported from the header later must not replace the
+		// validated ID
+		r.Header.Set(mdHTTP.HeaderKeyPrefix+requestid.MetadataKey, id)
+		w.Header().Set(requestid.Header, id)
+		src.ServeHTTP(w, r.WithContext(requestid.With(r.Context(), id)))
+	})
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mdHTTP "github.com/go-mixins/metadata/http"
+
+	"github.com/go-mixins/microservice/requestid"
+)
+
+func TestRequestID(t *testing.T) {
+	defer func(f func() string) { requestid.NewFunc = f }(requestid.NewFunc)
+	requestid.NewFunc = func() string { return "generated" }
+	for _, tc := range []struct {
+		name   string
+		header map[string]string
+		id     string
+	}{
+		{"new", nil, "generated"},
+		{"header", map[string]string{"X-Request-Id": "abc"}, "abc"},
+		{"metadata", map[string]string{"X-Meta-Request-Id": "abc"}, "abc"},
+		{"header over metadata", map[string]string{"X-Request-Id": "abc", "X-Meta-Request-Id": "def"}, "abc"},
+		{"invalid header", map[string]string{"X-Request-Id": "a b"}, "generated"},
+		{"too long", map[string]string{"X-Request-Id": strings.Repeat("a", requestid.MaxLength+1)}, "generated"},
+		{"invalid metadata", map[string]string{"X-Meta-Request-Id": "a\tb"}, "generated"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			// metadata imported inside must keep the validated ID
+			h := WithRequestID(&mdHTTP.Handler{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = requestid.From(r.Context())
+			})})
+			r := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tc.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got != tc.id {
+				t.Errorf("expected request ID %q, got %q", tc.id, got)
+			}
+			if h := w.Header().Get(requestid.Header); h != tc.id {
+				t.Errorf("expected response header %q, got %q", tc.id, h)
+			}
+		})
+	}
+}
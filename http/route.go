@@ -0,0 +1,62 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"go.opencensus.io/plugin/ochttp"
+)
+
+// RouteResolver returns route pattern for the request. The pattern is used in
+// metric tags and logs instead of raw path to keep their cardinality low.
+type RouteResolver interface {
+	Route(r *http.Request) string
+}
+
+// RouteResolverFunc adapts function to RouteResolver
+type RouteResolverFunc func(r *http.Request) string
+
+// Route implements RouteResolver
+func (f RouteResolverFunc) Route(r *http.Request) string {
+	return f(r)
+}
+
+// DefaultRouteResolver is used when no resolver is provided or the resolver
+// returns empty route
+var DefaultRouteResolver RouteResolver = RouteResolverFunc(func(r *http.Request) string {
+	return CollapsePath(r.URL.Path)
+})
+
+// IDPlaceholder replaces identifiers in collapsed paths
+var IDPlaceholder = ":id"
+
+var idSegment = regexp.MustCompile(`^(?:\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{24,})$`)
+
+// CollapsePath replaces numeric, UUID and long hexadecimal path segments with
+// IDPlaceholder
+func CollapsePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if idSegment.MatchString(s) {
+			segments[i] = IDPlaceholder
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+type routeKey struct{}
+
+// SetRoute overrides route pattern of the request handled by WithLog. It is
+// intended for routers that know the matched pattern only during dispatch.
+func SetRoute(r *http.Request, route string) {
+	if dest, ok := r.Context().Value(routeKey{}).(*string); ok {
+		*dest = route
+	}
+	ochttp.SetRoute(r.Context(), route)
+}
+
+func withRoute(ctx context.Context, route *string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
@@ -0,0 +1,180 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	pbjson "github.com/go-mixins/microservice/json"
+)
+
+// ContentTypeEventStream is used for Server-Sent Events
+const ContentTypeEventStream = "text/event-stream"
+
+// SSEHeartbeat is the interval of comments sent to keep idle event streams
+// open through proxies
+var SSEHeartbeat = 15 * time.Second
+
+// Event is a single Server-Sent Event. Empty Type means the default
+// "message" event.
+type Event struct {
+	ID   string
+	Type string
+	Data proto.Message
+}
+
+// EventStream writes Server-Sent Events encoded with the package codec. It is
+// safe for concurrent use. Sending fails with the context error once the
+// client disconnects or the stream is closed.
+type EventStream struct {
+	w     http.ResponseWriter
+	f     http.Flusher
+	ctx   context.Context
+	codec *pbjson.Codec
+	mu    sync.Mutex
+	err   error
+	stop  chan struct{}
+	once  sync.Once
+	last  string
+}
+
+// EventStreamFunc sends events to the stream until the client disconnects
+type EventStreamFunc func(s *EventStream) error
+
+// ServeEvents starts event stream response and calls f with the stream. The
+// stream is closed when f returns, so the response is not written after the
+// handler returns. It fails if the response writer can not be flushed.
+func ServeEvents(w http.ResponseWriter, r *http.Request, f EventStreamFunc) error {
+	s, err := newEventStream(w, r)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return f(s)
+}
+
+func newEventStream(w http.ResponseWriter, r *http.Request) (*EventStream, error) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("%T does not implement http.Flusher", w)
+	}
+	hdr := w.Header()
+	hdr.Set("Content-Type", ContentTypeEventStream+"; charset=utf-8")
+	// no-transform keeps compression and other middleware from buffering
+	hdr.Set("Cache-Control", "no-cache, no-transform")
+	hdr.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("lastEventId")
+	}
+	s := &EventStream{
+		w:     w,
+		f:     f,
+		ctx:   r.Context(),
+		codec: defaultCodec(false),
+		stop:  make(chan struct{}),
+		last:  last,
+	}
+	if SSEHeartbeat > 0 {
+		go s.heartbeat(SSEHeartbeat)
+	}
+	return s, nil
+}
+
+// LastEventID returns ID of the last event received by the client before
+// reconnection, so that the handler could resume the stream after it
+func (s *EventStream) LastEventID() string {
+	return s.last
+}
+
+// Done is closed when the client disconnects
+func (s *EventStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Send writes event and flushes it to the client
+func (s *EventStream) Send(e Event) error {
+	var buf bytes.Buffer
+	if e.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", sanitizeField(e.ID))
+	}
+	if e.Type != "" {
+		fmt.Fprintf(&buf, "event: %s\n", sanitizeField(e.Type))
+	}
+	data, err := s.codec.Encode(e.Data)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return s.write(buf.Bytes())
+}
+
+// Retry sets the client reconnection delay
+func (s *EventStream) Retry(d time.Duration) error {
+	return s.write([]byte(fmt.Sprintf("retry: %d\n\n", d.Milliseconds())))
+}
+
+// Close stops heartbeats and further sending. It is called by ServeEvents
+// and does not finish the response, which happens when the handler returns.
+func (s *EventStream) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = context.Canceled
+	}
+	return nil
+}
+
+func (s *EventStream) write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.err = err
+		return err
+	}
+	if _, err := s.w.Write(data); err != nil {
+		s.err = fmt.Errorf("writing event: %w", err)
+		return s.err
+	}
+	s.f.Flush()
+	return nil
+}
+
+func (s *EventStream) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.write([]byte(": ping\n\n")); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sanitizeField removes line breaks that would split event fields
+func sanitizeField(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,140 @@
+package http
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestServeEvents(t *testing.T) {
+	defer func(d time.Duration) { SSEHeartbeat = d }(SSEHeartbeat)
+	SSEHeartbeat = 0
+	for _, tc := range []struct {
+		name   string
+		query  string
+		header map[string]string
+		last   string
+	}{
+		{"new stream", "", nil, ""},
+		{"header", "", map[string]string{"Last-Event-ID": "41"}, "41"},
+		{"query", "?lastEventId=40", nil, "40"},
+		{"header over query", "?lastEventId=40", map[string]string{"Last-Event-ID": "41"}, "41"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var last string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err := ServeEvents(w, r, func(s *EventStream) error {
+					last = s.LastEventID()
+					if err := s.Retry(time.Second); err != nil {
+						return err
+					}
+					return s.Send(Event{ID: "42\n", Type: "update", Data: wrapperspb.String("a")})
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}))
+			defer srv.Close()
+			r, _ := http.NewRequest("GET", srv.URL+tc.query, nil)
+			for k, v := range tc.header {
+				r.Header.Set(k, v)
+			}
+			resp, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != ContentTypeEventStream+"; charset=utf-8" {
+				t.Errorf("unexpected Content-Type %q", ct)
+			}
+			if cc := resp.Header.Get("Cache-Control"); cc != "no-cache, no-transform" {
+				t.Errorf("unexpected Cache-Control %q", cc)
+			}
+			if want := "retry: 1000\n\nid: 42\nevent: update\ndata: \"a\"\n\n"; string(data) != want {
+				t.Errorf("expected %q, got %q", want, data)
+			}
+			if last != tc.last {
+				t.Errorf("expected last event ID %q, got %q", tc.last, last)
+			}
+		})
+	}
+}
+
+func TestEventStreamHeartbeat(t *testing.T) {
+	defer func(d time.Duration) { SSEHeartbeat = d }(SSEHeartbeat)
+	SSEHeartbeat = 10 * time.Millisecond
+	done := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done <- ServeEvents(w, r, func(s *EventStream) error {
+			<-s.Done()
+			return nil
+		})
+	}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(resp.Body)
+	for i := 0; i < 2; i++ {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != ": ping\n" {
+			t.Fatalf("expected heartbeat, got %q", line)
+		}
+		if line, _ = br.ReadString('\n'); line != "\n" {
+			t.Fatalf("expected empty line, got %q", line)
+		}
+	}
+	resp.Body.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("stream is not closed after client disconnect")
+	}
+}
+
+func TestEventStreamClosed(t *testing.T) {
+	defer func(d time.Duration) { SSEHeartbeat = d }(SSEHeartbeat)
+	SSEHeartbeat = 0
+	w := httptest.NewRecorder()
+	var stream *EventStream
+	if err := ServeEvents(w, httptest.NewRequest("GET", "/", nil), func(s *EventStream) error {
+		stream = s
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(Event{Data: wrapperspb.String("a")}); err == nil {
+		t.Error("expected error sending to closed stream")
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), ContentTypeEventStream) || w.Body.Len() != 0 {
+		t.Errorf("unexpected response %q", w.Body.String())
+	}
+}
+
+func TestServeEventsNotFlusher(t *testing.T) {
+	w := struct{ http.ResponseWriter }{httptest.NewRecorder()}
+	err := ServeEvents(w, httptest.NewRequest("GET", "/", nil), func(s *EventStream) error {
+		t.Error("stream is started")
+		return nil
+	})
+	if err == nil {
+		t.Error("expected error")
+	}
+}
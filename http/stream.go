@@ -0,0 +1,31 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	pbjson "github.com/go-mixins/microservice/json"
+)
+
+// ContentTypeNDJSON is used for newline-delimited JSON streams
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// StreamJSON prepares response for streaming of message sequence with
+// bounded memory. NDJSON is used if the client accepts it, otherwise the
+// messages are written as JSON array. Each message is flushed to the client
+// as soon as it is encoded. The returned encoder must be closed after the
+// last message.
+func StreamJSON(w http.ResponseWriter, r *http.Request) *pbjson.Encoder {
+	format, contentType := pbjson.Array, ContentTypeJSON
+	if accept := r.Header.Get("Accept"); strings.Contains(accept, ContentTypeNDJSON) || strings.Contains(accept, "application/jsonl") {
+		format, contentType = pbjson.NDJSON, ContentTypeNDJSON
+	}
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	return defaultCodec(false).NewEncoder(w, format)
+}
+
+// DecodeStream reads message sequence in NDJSON or JSON array format from
+// request body
+func DecodeStream(r *http.Request) *pbjson.Decoder {
+	return defaultCodec(false).NewDecoder(r.Body)
+}
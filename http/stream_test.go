@@ -0,0 +1,70 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+	}{
+		{"", ContentTypeJSON},
+		{"application/json", ContentTypeJSON},
+		{"application/x-ndjson", ContentTypeNDJSON},
+		{"application/jsonl, */*", ContentTypeNDJSON},
+	} {
+		for _, n := range []int{0, 2} {
+			t.Run(fmt.Sprintf("%s/%d", tc.accept, n), func(t *testing.T) {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Header.Set("Accept", tc.accept)
+				w := httptest.NewRecorder()
+				enc := StreamJSON(w, r)
+				var items []*structpb.Struct
+				for i := 0; i < n; i++ {
+					s, err := structpb.NewStruct(map[string]interface{}{"id": float64(i)})
+					if err != nil {
+						t.Fatal(err)
+					}
+					items = append(items, s)
+					if err := enc.Encode(s); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := enc.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tc.contentType) {
+					t.Errorf("content type %q, expected %q", ct, tc.contentType)
+				}
+				if !w.Flushed && n > 0 {
+					t.Error("stream is not flushed")
+				}
+				dec := DecodeStream(httptest.NewRequest("POST", "/", w.Body))
+				for i := 0; ; i++ {
+					s := new(structpb.Struct)
+					err := dec.Decode(s)
+					if err == io.EOF {
+						if i != n {
+							t.Errorf("decoded %d messages, expected %d", i, n)
+						}
+						break
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if i >= n || !proto.Equal(s, items[i]) {
+						t.Fatalf("unexpected message %d: %v", i, s)
+					}
+				}
+			})
+		}
+	}
+}
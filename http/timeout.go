@@ -0,0 +1,142 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/go-mixins/microservice/config"
+	"github.com/go-mixins/microservice/errors"
+)
+
+// TimeoutHeader carries the client deadline. Its value is either in
+// grpc-timeout format, e.g. "250m" for 250 milliseconds, or a Go duration
+// like "1.5s".
+const TimeoutHeader = "X-Request-Timeout"
+
+// TimeoutConfig defines deadlines of incoming requests. Routes are matched by
+// "METHOD route" first and then by route alone. Max caps the route and
+// default timeouts, client-provided timeout may only shorten the result.
+// Zero Default and Max disable respective limits. Zero route timeout
+// disables the deadline of the route even when Max is set. Upgrade requests
+// and requests accepting event streams are long-lived, so Default and Max do
+// not apply to them, only route and client timeouts do.
+type TimeoutConfig struct {
+	Default time.Duration   `envconfig:"HTTP_TIMEOUT"`
+	Max     time.Duration   `envconfig:"HTTP_MAX_TIMEOUT"`
+	Routes  config.Timeouts `envconfig:"HTTP_ROUTE_TIMEOUTS"`
+}
+
+var grpcTimeout = regexp.MustCompile(`^(\d{1,8})([HMSmun])$`)
+
+var grpcTimeoutUnits = map[string]time.Duration{
+	"H": time.Hour,
+	"M": time.Minute,
+	"S": time.Second,
+	"m": time.Millisecond,
+	"u": time.Microsecond,
+	"n": time.Nanosecond,
+}
+
+// ParseTimeout parses value of TimeoutHeader
+func ParseTimeout(value string) (time.Duration, error) {
+	if m := grpcTimeout.FindStringSubmatch(value); m != nil {
+		n, _ := strconv.ParseInt(m[1], 10, 64)
+		if n == 0 {
+			return 0, fmt.Errorf("non-positive timeout %q", value)
+		}
+		unit := grpcTimeoutUnits[m[2]]
+		if n > math.MaxInt64/int64(unit) {
+			return math.MaxInt64, nil
+		}
+		return time.Duration(n) * unit, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err == nil && d <= 0 {
+		return 0, fmt.Errorf("non-positive timeout %q", value)
+	}
+	return d, err
+}
+
+// longLived reports whether the request is a WebSocket or other protocol
+// upgrade, or accepts Server-Sent Events
+func longLived(r *http.Request) bool {
+	if r.Header.Get("Upgrade") != "" {
+		return true
+	}
+	for _, v := range r.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(v, ",") {
+			if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+				mediaType = mediaType[:i]
+			}
+			if strings.EqualFold(strings.TrimSpace(mediaType), ContentTypeEventStream) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (cfg *TimeoutConfig) timeout(r *http.Request, resolver RouteResolver) (time.Duration, error) {
+	res, max := cfg.Default, cfg.Max
+	if longLived(r) {
+		res, max = 0, 0
+	}
+	if len(cfg.Routes) > 0 {
+		route := resolver.Route(r)
+		if d, ok := cfg.Routes.Lookup(r.Method+" "+route, route); ok {
+			if d <= 0 {
+				return 0, nil
+			}
+			res = d
+		}
+	}
+	if max > 0 && (res <= 0 || res > max) {
+		res = max
+	}
+	if value := r.Header.Get(TimeoutHeader); value != "" {
+		d, err := ParseTimeout(value)
+		if err != nil {
+			return 0, errors.Errorf(codes.InvalidArgument, "invalid %s header", TimeoutHeader).Wrap(err)
+		}
+		if res <= 0 || d < res {
+			res = d
+		}
+	}
+	return res, nil
+}
+
+// WithTimeout обвязывает http.Handler для ограничения времени обработки
+// запроса. Если обработчик вернулся по истечении срока, ничего не записав
+// в ответ, клиенту отдаётся 504.
+func WithTimeout(src http.Handler, cfg TimeoutConfig, resolver RouteResolver) http.Handler {
+	if resolver == nil {
+		resolver = DefaultRouteResolver
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout, err := cfg.timeout(r, resolver)
+		if err != nil {
+			RenderError(w, r, err)
+			return
+		}
+		if timeout <= 0 {
+			src.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+		sw := newStatusWriter(w)
+		src.ServeHTTP(exposeCapabilities(sw, w), r)
+		if ctx.Err() == context.DeadlineExceeded && sw.status == 0 && !sw.hijacked {
+			RenderError(sw, r, errors.Errorf(codes.DeadlineExceeded, "request timed out after %v", timeout))
+		}
+	})
+}
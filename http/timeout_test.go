@@ -0,0 +1,102 @@
+package http
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-mixins/microservice/config"
+)
+
+func TestParseTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		d     time.Duration
+		ok    bool
+	}{
+		{"250m", 250 * time.Millisecond, true},
+		{"2S", 2 * time.Second, true},
+		{"1.5s", 1500 * time.Millisecond, true},
+		{"99999999H", math.MaxInt64, true},
+		{"99999999n", 99999999, true},
+		{"0S", 0, false},
+		{"-1s", 0, false},
+		{"100000000S", 0, false},
+		{"soon", 0, false},
+	} {
+		d, err := ParseTimeout(tc.value)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: unexpected error %v", tc.value, err)
+			continue
+		}
+		if tc.ok && d != tc.d {
+			t.Errorf("%s: expected %v, got %v", tc.value, tc.d, d)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	cfg := TimeoutConfig{
+		Default: time.Second,
+		Max:     time.Minute,
+		Routes:  config.Timeouts{"GET /slow": 10 * time.Minute, "/free": 0, "/events": 5 * time.Second},
+	}
+	for _, tc := range []struct {
+		name     string
+		path     string
+		header   map[string]string
+		deadline time.Duration
+		status   int
+	}{
+		{"default", "/", nil, time.Second, http.StatusOK},
+		{"route capped by max", "/slow", nil, time.Minute, http.StatusOK},
+		{"disabled route", "/free", nil, 0, http.StatusOK},
+		{"client timeout", "/", map[string]string{TimeoutHeader: "100m"}, 100 * time.Millisecond, http.StatusOK},
+		{"longer client timeout", "/", map[string]string{TimeoutHeader: "1M"}, time.Second, http.StatusOK},
+		{"huge client timeout", "/", map[string]string{TimeoutHeader: "99999999H"}, time.Second, http.StatusOK},
+		{"invalid client timeout", "/", map[string]string{TimeoutHeader: "soon"}, 0, http.StatusBadRequest},
+		{"event stream", "/", map[string]string{"Accept": "text/html, Text/Event-Stream;q=0.9"}, 0, http.StatusOK},
+		{"websocket", "/", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"}, 0, http.StatusOK},
+		{"event stream route", "/events", map[string]string{"Accept": ContentTypeEventStream}, 5 * time.Second, http.StatusOK},
+		{"event stream client timeout", "/", map[string]string{"Accept": ContentTypeEventStream, TimeoutHeader: "1M"}, time.Minute, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var deadline time.Duration
+			called := false
+			h := WithTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				if d, ok := r.Context().Deadline(); ok {
+					deadline = time.Until(d).Round(time.Millisecond * 100)
+				}
+			}), cfg, RouteResolverFunc(func(r *http.Request) string { return r.URL.Path }))
+			r := httptest.NewRequest("GET", tc.path, nil)
+			for k, v := range tc.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, w.Code)
+			}
+			if called != (tc.status == http.StatusOK) {
+				t.Errorf("unexpected handler call: %v", called)
+			}
+			if deadline != tc.deadline {
+				t.Errorf("expected deadline in %v, got %v", tc.deadline, deadline)
+			}
+		})
+	}
+}
+
+func TestTimeoutExpired(t *testing.T) {
+	h := WithTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}), TimeoutConfig{Default: time.Millisecond}, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status 504, got %d", w.Code)
+	}
+}
@@ -0,0 +1,250 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-mixins/log"
+	"go.opencensus.io/trace"
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/proto"
+)
+
+// WebSocket close codes
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseInternalError = 1011
+)
+
+// WebSocketCheckOrigin decides whether to accept the upgrade request. By
+// default requests without Origin and from the same host are accepted.
+var WebSocketCheckOrigin = func(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// WebSocketFunc handles WebSocket connection. The connection is closed when
+// the function returns, with internal error code if it returns error.
+type WebSocketFunc func(conn *WebSocketConn) error
+
+// WebSocketConn exchanges protojson-encoded messages in text frames. Send
+// and Receive may be called concurrently with each other.
+type WebSocketConn struct {
+	ws     *websocket.Conn
+	ctx    context.Context
+	codec  websocket.Codec
+	once   sync.Once
+	closed chan struct{}
+}
+
+// Context returns request context with logger and trace span. It is
+// canceled when the connection is closed.
+func (c *WebSocketConn) Context() context.Context {
+	return c.ctx
+}
+
+// Request returns the upgrade request
+func (c *WebSocketConn) Request() *http.Request {
+	return c.ws.Request()
+}
+
+// Send writes message to the client
+func (c *WebSocketConn) Send(msg proto.Message) error {
+	select {
+	case <-c.closed:
+		return io.EOF
+	default:
+	}
+	if err := c.codec.Send(c.ws, msg); err != nil {
+		return fmt.Errorf("sending message: %w", err)
+	}
+	return nil
+}
+
+// Receive reads next message from the client. It returns io.EOF once the
+// connection is closed by either side.
+func (c *WebSocketConn) Receive(msg proto.Message) error {
+	err := c.codec.Receive(c.ws, msg)
+	select {
+	case <-c.closed:
+		return io.EOF
+	default:
+	}
+	if err == io.EOF {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("receiving message: %w", err)
+	}
+	return nil
+}
+
+// Close sends close frame with the code and interrupts pending Receive.
+// Subsequent calls have no effect.
+func (c *WebSocketConn) Close(code int) error {
+	var err error
+	c.once.Do(func() {
+		close(c.closed)
+		err = c.ws.WriteClose(code)
+		_ = c.ws.SetReadDeadline(time.Now())
+	})
+	return err
+}
+
+type webSocketRegistry struct {
+	conns   map[*WebSocketConn]struct{}
+	closing bool
+}
+
+// webSockets tracks connections by the server that accepted them, so that
+// shutdown of one server does not affect others
+var webSockets = struct {
+	sync.Mutex
+	servers map[*http.Server]*webSocketRegistry
+}{servers: make(map[*http.Server]*webSocketRegistry)}
+
+func webSocketServer(r *http.Request) *http.Server {
+	srv, _ := r.Context().Value(http.ServerContextKey).(*http.Server)
+	return srv
+}
+
+func webSocketsClosing(srv *http.Server) bool {
+	webSockets.Lock()
+	defer webSockets.Unlock()
+	reg, ok := webSockets.servers[srv]
+	return ok && reg.closing
+}
+
+func addWebSocket(srv *http.Server, c *WebSocketConn) bool {
+	webSockets.Lock()
+	defer webSockets.Unlock()
+	reg, ok := webSockets.servers[srv]
+	if !ok {
+		reg = &webSocketRegistry{conns: make(map[*WebSocketConn]struct{})}
+		webSockets.servers[srv] = reg
+	}
+	if reg.closing {
+		return false
+	}
+	reg.conns[c] = struct{}{}
+	return true
+}
+
+func removeWebSocket(srv *http.Server, c *WebSocketConn) {
+	webSockets.Lock()
+	defer webSockets.Unlock()
+	reg, ok := webSockets.servers[srv]
+	if !ok {
+		return
+	}
+	delete(reg.conns, c)
+	if len(reg.conns) == 0 {
+		delete(webSockets.servers, srv)
+	}
+}
+
+// CloseWebSockets closes WebSocket connections accepted by the server with
+// going away code and rejects new ones until they are closed. It is intended
+// for http.Server.RegisterOnShutdown, since Shutdown does not track hijacked
+// connections. The server is forgotten once its last connection is closed.
+func CloseWebSockets(srv *http.Server) {
+	webSockets.Lock()
+	reg, ok := webSockets.servers[srv]
+	if !ok {
+		webSockets.Unlock()
+		return
+	}
+	reg.closing = true
+	conns := make([]*WebSocketConn, 0, len(reg.conns))
+	for c := range reg.conns {
+		conns = append(conns, c)
+	}
+	webSockets.Unlock()
+	for _, c := range conns {
+		_ = c.Close(CloseGoingAway)
+	}
+}
+
+var protoWebSocketCodec = websocket.Codec{
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		msg, ok := v.(proto.Message)
+		if !ok {
+			return nil, 0, fmt.Errorf("%T is not a proto message", v)
+		}
+		data, err := defaultCodec(false).Encode(msg)
+		return data, websocket.TextFrame, err
+	},
+	Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+		if payloadType != websocket.TextFrame {
+			return fmt.Errorf("unexpected binary frame")
+		}
+		msg, ok := v.(proto.Message)
+		if !ok {
+			return fmt.Errorf("%T is not a proto message", v)
+		}
+		return defaultCodec(false).Decode(data, msg)
+	},
+}
+
+// WebSocket создает http.Handler для обработки соединений WebSocket. Запрос
+// проходит через обычную цепочку middleware, поэтому соединение получает лог
+// и трассировку запроса. Соединения закрываются при остановке сервера.
+func WebSocket(f WebSocketFunc) http.Handler {
+	return websocket.Server{
+		Handshake: func(cfg *websocket.Config, r *http.Request) error {
+			if webSocketsClosing(webSocketServer(r)) {
+				return fmt.Errorf("server is shutting down")
+			}
+			if !WebSocketCheckOrigin(r) {
+				return fmt.Errorf("origin %q is not allowed", r.Header.Get("Origin"))
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			r := ws.Request()
+			srv := webSocketServer(r)
+			logger := log.Get(r.Context()).WithContext(log.M{"protocol": "websocket"})
+			ctx, cancel := context.WithCancel(log.With(r.Context(), logger))
+			defer cancel()
+			span := trace.FromContext(ctx)
+			conn := &WebSocketConn{
+				ws:     ws,
+				ctx:    ctx,
+				codec:  protoWebSocketCodec,
+				closed: make(chan struct{}),
+			}
+			if !addWebSocket(srv, conn) {
+				_ = conn.Close(CloseGoingAway)
+				return
+			}
+			defer removeWebSocket(srv, conn)
+			go func() {
+				select {
+				case <-ctx.Done():
+					_ = conn.Close(CloseGoingAway)
+				case <-conn.closed:
+				}
+			}()
+			span.Annotate(nil, "websocket opened")
+			logger.Debugf("websocket opened")
+			code := CloseNormal
+			if err := f(conn); err != nil {
+				code = CloseInternalError
+				logger.Errorf("websocket handler: %+v", err)
+			}
+			_ = conn.Close(code)
+			span.Annotate([]trace.Attribute{trace.Int64Attribute("close_code", int64(code))}, "websocket closed")
+			logger.Debugf("websocket closed")
+		},
+	}
+}
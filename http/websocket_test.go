@@ -0,0 +1,224 @@
+package http
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-mixins/log"
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// entryLogger records messages with their fields
+type entryLogger struct {
+	log.ContextLogger
+	fields  log.M
+	mu      *sync.Mutex
+	entries *[]log.M
+}
+
+func newEntryLogger() *entryLogger {
+	return &entryLogger{
+		ContextLogger: log.Get(context.Background()),
+		mu:            new(sync.Mutex),
+		entries:       new([]log.M),
+	}
+}
+
+func (l *entryLogger) WithContext(m log.M) log.ContextLogger {
+	fields := log.M{}
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for k, v := range m {
+		fields[k] = v
+	}
+	res := *l
+	res.fields = fields
+	return &res
+}
+
+func (l *entryLogger) record(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry := log.M{"msg": fmt.Sprintf(format, args...)}
+	for k, v := range l.fields {
+		entry[k] = v
+	}
+	*l.entries = append(*l.entries, entry)
+}
+
+func (l *entryLogger) Debugf(format string, args ...interface{}) { l.record(format, args...) }
+func (l *entryLogger) Infof(format string, args ...interface{})  { l.record(format, args...) }
+func (l *entryLogger) Warnf(format string, args ...interface{})  { l.record(format, args...) }
+func (l *entryLogger) Errorf(format string, args ...interface{}) { l.record(format, args...) }
+
+// waitEntry waits for the message to be logged and returns its fields
+func (l *entryLogger) waitEntry(t *testing.T, msg string) log.M {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		l.mu.Lock()
+		for _, e := range *l.entries {
+			if strings.HasPrefix(e["msg"].(string), msg) {
+				l.mu.Unlock()
+				return e
+			}
+		}
+		l.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%q is not logged", msg)
+	return nil
+}
+
+// startWebSocketServer starts server with WebSocket echo handler behind the
+// application middleware chain
+func startWebSocketServer(t *testing.T, logger log.ContextLogger) *httptest.Server {
+	t.Helper()
+	routes := RouteResolverFunc(func(r *http.Request) string { return r.URL.Path })
+	var handler http.Handler = WebSocket(func(c *WebSocketConn) error {
+		for {
+			msg := new(wrapperspb.StringValue)
+			if err := c.Receive(msg); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := c.Send(wrapperspb.String("echo: " + msg.Value)); err != nil {
+				return err
+			}
+		}
+	})
+	handler = WithPrefix(handler, "/api", http.NotFoundHandler())
+	handler = WithCache(handler, CacheRoutes(routes), CacheRoute("/api/ws", CachePolicy{}))
+	handler = WithCompression(handler, testCompressConfig)
+	handler = WithTimeout(handler, TimeoutConfig{Default: 20 * time.Millisecond}, routes)
+	handler = WithLog(handler, logger, LogRoutes(routes))
+	handler = WithClientIP(handler, nil)
+	handler = WithRequestID(handler)
+	handler = WithTracing(handler)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func dialWebSocket(t *testing.T, srv *httptest.Server) *websocket.Conn {
+	t.Helper()
+	cfg, err := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/ws", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Header.Set("Accept-Encoding", "gzip")
+	ws, err := websocket.DialConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ws.Close() })
+	return ws
+}
+
+// readClose skips data frames and returns code of the close frame
+func readClose(t *testing.T, ws *websocket.Conn) int {
+	t.Helper()
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		fr, err := ws.NewFrameReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(fr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fr.PayloadType() == websocket.CloseFrame && len(data) >= 2 {
+			return int(binary.BigEndian.Uint16(data))
+		}
+	}
+}
+
+func webSocketRegistered(srv *http.Server) bool {
+	webSockets.Lock()
+	defer webSockets.Unlock()
+	_, ok := webSockets.servers[srv]
+	return ok
+}
+
+func TestWebSocket(t *testing.T) {
+	logger := newEntryLogger()
+	srv := startWebSocketServer(t, logger)
+	ws := dialWebSocket(t, srv)
+	for _, s := range []string{"hello", "world"} {
+		if err := websocket.Message.Send(ws, `"`+s+`"`); err != nil {
+			t.Fatal(err)
+		}
+		var reply string
+		if err := websocket.Message.Receive(ws, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply != `"echo: `+s+`"` {
+			t.Errorf("unexpected reply %q", reply)
+		}
+		// the connection outlives the default request timeout
+		time.Sleep(30 * time.Millisecond)
+	}
+	if err := ws.Close(); err != nil {
+		t.Fatal(err)
+	}
+	entry := logger.waitEntry(t, "finished request")
+	if entry["code"] != http.StatusSwitchingProtocols {
+		t.Errorf("expected code 101 to be logged, got %v", entry["code"])
+	}
+	if entry["http_route"] != "/api/ws" || entry["request_id"] == "" {
+		t.Errorf("unexpected log entry %v", entry)
+	}
+	if webSocketRegistered(srv.Config) {
+		t.Error("closed connection is left registered")
+	}
+}
+
+func TestWebSocketBinaryFrame(t *testing.T) {
+	logger := newEntryLogger()
+	srv := startWebSocketServer(t, logger)
+	ws := dialWebSocket(t, srv)
+	if err := websocket.Message.Send(ws, []byte(`"hello"`)); err != nil {
+		t.Fatal(err)
+	}
+	if code := readClose(t, ws); code != CloseInternalError {
+		t.Errorf("expected close code %d, got %d", CloseInternalError, code)
+	}
+	if entry := logger.waitEntry(t, "websocket handler"); !strings.Contains(entry["msg"].(string), "binary frame") {
+		t.Errorf("unexpected error %q", entry["msg"])
+	}
+}
+
+func TestCloseWebSockets(t *testing.T) {
+	srv := startWebSocketServer(t, newEntryLogger())
+	ws := dialWebSocket(t, srv)
+	// the round trip ensures the connection is registered
+	if err := websocket.Message.Send(ws, `"hello"`); err != nil {
+		t.Fatal(err)
+	}
+	var reply string
+	if err := websocket.Message.Receive(ws, &reply); err != nil {
+		t.Fatal(err)
+	}
+	CloseWebSockets(srv.Config)
+	if code := readClose(t, ws); code != CloseGoingAway {
+		t.Errorf("expected close code %d, got %d", CloseGoingAway, code)
+	}
+	for i := 0; i < 100 && webSocketRegistered(srv.Config); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if webSocketRegistered(srv.Config) {
+		t.Error("server is left registered after its connections are closed")
+	}
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// statusWriter captures response status code and size. Use exposeCapabilities
+// to pass it to handlers.
+type statusWriter struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64
+	hijacked bool
+}
+
+func newStatusWriter(w http.ResponseWriter) *statusWriter {
+	return &statusWriter{ResponseWriter: w}
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Status returns response code sent to the client
+func (w *statusWriter) Status() int {
+	if w.status == 0 && !w.hijacked {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not implement http.Hijacker", w.ResponseWriter)
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.hijacked = true
+		if w.status == 0 {
+			w.status = http.StatusSwitchingProtocols
+		}
+	}
+	return conn, rw, err
+}
+
+func (w *statusWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// responseWriter is implemented by the writers of this package, which pass
+// the optional interfaces through regardless of the wrapped ResponseWriter
+type responseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+}
+
+// writerBase is embedded by the writers returned from exposeCapabilities
+type writerBase struct {
+	http.ResponseWriter
+	orig http.ResponseWriter
+}
+
+// Unwrap returns the original ResponseWriter for http.ResponseController
+func (w writerBase) Unwrap() http.ResponseWriter {
+	return w.orig
+}
+
+func (w writerBase) inner() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// exposeCapabilities returns w implementing only those of http.Flusher,
+// http.Hijacker and http.Pusher that are implemented by orig, which w wraps,
+// so that handlers can rely on type assertions
+func exposeCapabilities(w responseWriter, orig http.ResponseWriter) http.ResponseWriter {
+	base := writerBase{w, orig}
+	_, f := orig.(http.Flusher)
+	_, h := orig.(http.Hijacker)
+	_, p := orig.(http.Pusher)
+	switch {
+	case f && h && p:
+		return struct {
+			writerBase
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{base, w, w, w}
+	case f && h:
+		return struct {
+			writerBase
+			http.Flusher
+			http.Hijacker
+		}{base, w, w}
+	case f && p:
+		return struct {
+			writerBase
+			http.Flusher
+			http.Pusher
+		}{base, w, w}
+	case h && p:
+		return struct {
+			writerBase
+			http.Hijacker
+			http.Pusher
+		}{base, w, w}
+	case f:
+		return struct {
+			writerBase
+			http.Flusher
+		}{base, w}
+	case h:
+		return struct {
+			writerBase
+			http.Hijacker
+		}{base, w}
+	case p:
+		return struct {
+			writerBase
+			http.Pusher
+		}{base, w}
+	}
+	return base
+}
+
+// innerWriter returns the writer passed to exposeCapabilities
+func innerWriter(w http.ResponseWriter) http.ResponseWriter {
+	if iw, ok := w.(interface{ inner() http.ResponseWriter }); ok {
+		return iw.inner()
+	}
+	return w
+}
@@ -0,0 +1,184 @@
+// Package idempotency stores results of mutating calls by client-provided
+// idempotency keys, so that retried requests get the original response
+// instead of being executed again.
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/go-mixins/microservice/errors"
+)
+
+// Header carries idempotency key in HTTP requests and gRPC metadata
+const Header = "Idempotency-Key"
+
+// ReplayedHeader marks responses replayed from the store
+const ReplayedHeader = "Idempotent-Replayed"
+
+// MaxKeyLength limits accepted idempotency keys
+const MaxKeyLength = 255
+
+// MaxResponseSize limits stored responses. Keys of calls with larger
+// responses are released, so that the calls could be repeated.
+var MaxResponseSize = 64 << 10
+
+// Replaceable functions
+var (
+	NowFunc = time.Now
+)
+
+// Errors returned by stores and middleware
+var (
+	ErrInProgress = errors.New(codes.Aborted, "request with the same idempotency key is in progress")
+	ErrInvalidKey = errors.New(codes.InvalidArgument, "invalid idempotency key")
+	ErrKeyReused  = errors.New(codes.FailedPrecondition, "idempotency key was used with a different request").WithHTTPStatus(http.StatusUnprocessableEntity)
+	ErrStoreFull  = errors.New(codes.ResourceExhausted, "too many requests with idempotency keys in progress")
+)
+
+// Config defines the in-memory store created by the application when it is
+// enabled and the handler does not provide its own store. The application
+// uses the store for gRPC calls only, HTTP handlers install WithIdempotency
+// after their authentication with a store of their own.
+type Config struct {
+	Enabled bool          `envconfig:"IDEMPOTENCY_ENABLED"`
+	Size    int           `envconfig:"IDEMPOTENCY_CACHE_SIZE" default:"10000"`
+	TTL     time.Duration `envconfig:"IDEMPOTENCY_TTL" default:"24h"`
+}
+
+// Scope returns identity of the caller that idempotency keys are bound to,
+// e.g. user or tenant ID put into context by authentication. It must run
+// after authentication. Calls with empty scope are not deduplicated.
+type Scope func(ctx context.Context) string
+
+// Response is a stored result of the call. Status holds HTTP status or gRPC
+// code, Body holds response body or serialized message. RequestHash
+// identifies the request, so that reuse of the key with a different request
+// could be detected.
+type Response struct {
+	Status      int
+	Header      http.Header
+	Body        []byte
+	RequestHash string
+}
+
+// Store keeps responses by key. Implementations backed by Redis or SQL must
+// make Begin atomic across application instances.
+type Store interface {
+	// Begin reserves the key for the call. It returns stored response if the
+	// call has completed, or ErrInProgress if it is still running.
+	Begin(ctx context.Context, key string) (*Response, error)
+	// Complete stores response of the call reserved by Begin
+	Complete(ctx context.Context, key string, res *Response) error
+	// Release drops reservation of the failed call, so it could be retried
+	Release(ctx context.Context, key string) error
+}
+
+// ValidKey reports whether key received from the client may be accepted
+func ValidKey(key string) bool {
+	if key == "" || len(key) > MaxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+type entry struct {
+	key     string
+	res     *Response
+	expires time.Time
+}
+
+// MemoryStore is an in-process LRU store with entries expiring after TTL.
+// Reservations of calls in progress are never evicted, they expire after TTL
+// if the calls never complete. Begin fails with ErrStoreFull when the store
+// holds only reservations.
+type MemoryStore struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[string]*list.Element
+	lru   *list.List
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates store holding at most cfg.Size entries
+func NewMemoryStore(cfg Config) *MemoryStore {
+	return &MemoryStore{
+		size:  cfg.Size,
+		ttl:   cfg.TTL,
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+// Begin implements Store
+func (s *MemoryStore) Begin(ctx context.Context, key string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := NowFunc()
+	if el, ok := s.items[key]; ok {
+		e := el.Value.(*entry)
+		if now.Before(e.expires) {
+			if e.res == nil {
+				return nil, ErrInProgress
+			}
+			s.lru.MoveToFront(el)
+			return e.res, nil
+		}
+		s.remove(el)
+	}
+	if s.size > 0 && s.lru.Len() >= s.size && !s.evict(now) {
+		return nil, ErrStoreFull
+	}
+	s.items[key] = s.lru.PushFront(&entry{key: key, expires: now.Add(s.ttl)})
+	return nil, nil
+}
+
+// evict removes the least recently used completed or expired entry
+func (s *MemoryStore) evict(now time.Time) bool {
+	for el := s.lru.Back(); el != nil; el = el.Prev() {
+		if e := el.Value.(*entry); e.res != nil || !now.Before(e.expires) {
+			s.remove(el)
+			return true
+		}
+	}
+	return false
+}
+
+// Complete implements Store
+func (s *MemoryStore) Complete(ctx context.Context, key string, res *Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		e := el.Value.(*entry)
+		e.res, e.expires = res, NowFunc().Add(s.ttl)
+		s.lru.MoveToFront(el)
+	}
+	return nil
+}
+
+// Release implements Store
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok && el.Value.(*entry).res == nil {
+		s.remove(el)
+	}
+	return nil
+}
+
+func (s *MemoryStore) remove(el *list.Element) {
+	s.lru.Remove(el)
+	delete(s.items, el.Value.(*entry).key)
+}
@@ -9,35 +9,94 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-// Дефолтные кодеки
-var (
-	DefaultMarshaler = &jsonpb.MarshalOptions{
-		Multiline:       true,
-		Indent:          "\t",
-		EmitUnpopulated: true,
-		UseProtoNames:   true,
+// Codec marshals and unmarshals proto messages to and from JSON
+type Codec struct {
+	Marshaler   jsonpb.MarshalOptions
+	Unmarshaler jsonpb.UnmarshalOptions
+}
+
+// Option modifies codec settings
+type Option func(*Codec)
+
+// NewCodec creates codec that emits unpopulated fields with proto names and
+// discards unknown fields on input. Options are applied in order.
+func NewCodec(opts ...Option) *Codec {
+	res := &Codec{
+		Marshaler: jsonpb.MarshalOptions{
+			EmitUnpopulated: true,
+			UseProtoNames:   true,
+		},
+		Unmarshaler: jsonpb.UnmarshalOptions{
+			DiscardUnknown: true,
+		},
 	}
+	for _, o := range opts {
+		o(res)
+	}
+	return res
+}
 
-	DefaultUnmarshaler = &jsonpb.UnmarshalOptions{
-		DiscardUnknown: true,
+// Multiline enables indented output
+func Multiline(indent string) Option {
+	return func(c *Codec) {
+		c.Marshaler.Multiline = true
+		c.Marshaler.Indent = indent
 	}
-)
+}
 
-// Unmarshal convenience wrapper
-func Unmarshal(r io.Reader, pb proto.Message) error {
+// JSONNames makes output use lowerCamelCase JSON names instead of proto
+// names
+func JSONNames() Option {
+	return func(c *Codec) {
+		c.Marshaler.UseProtoNames = false
+	}
+}
+
+// OmitUnpopulated skips fields with default values on output
+func OmitUnpopulated() Option {
+	return func(c *Codec) {
+		c.Marshaler.EmitUnpopulated = false
+	}
+}
+
+// StrictUnknownFields rejects input with unknown fields
+func StrictUnknownFields() Option {
+	return func(c *Codec) {
+		c.Unmarshaler.DiscardUnknown = false
+	}
+}
+
+// WithResolver sets type resolver for google.protobuf.Any and extensions
+func WithResolver(r Resolver) Option {
+	return func(c *Codec) {
+		c.Marshaler.Resolver = r
+		c.Unmarshaler.Resolver = r
+	}
+}
+
+// SingleLine returns copy of the codec without indentation
+func (c *Codec) SingleLine() *Codec {
+	res := *c
+	res.Marshaler.Multiline = false
+	res.Marshaler.Indent = ""
+	return &res
+}
+
+// Unmarshal message from reader
+func (c *Codec) Unmarshal(r io.Reader, pb proto.Message) error {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return err
 	}
-	if err := DefaultUnmarshaler.Unmarshal(data, pb); err != nil {
+	if err := c.Unmarshaler.Unmarshal(data, pb); err != nil {
 		return fmt.Errorf("unmarshal JSON: %w", err)
 	}
 	return nil
 }
 
-// Marshal convenience wrapper
-func Marshal(out io.Writer, pb proto.Message) error {
-	data, err := DefaultMarshaler.Marshal(pb)
+// Marshal message to writer
+func (c *Codec) Marshal(out io.Writer, pb proto.Message) error {
+	data, err := c.Marshaler.Marshal(pb)
 	if err != nil {
 		return fmt.Errorf("marshal to JSON: %w", err)
 	}
@@ -45,12 +104,63 @@ func Marshal(out io.Writer, pb proto.Message) error {
 	return err
 }
 
+// Encode object to JSON
+func (c *Codec) Encode(src proto.Message) ([]byte, error) {
+	return c.Marshaler.Marshal(src)
+}
+
+// Decode object from JSON
+func (c *Codec) Decode(data []byte, dest proto.Message) error {
+	return c.Unmarshaler.Unmarshal(data, dest)
+}
+
+// Codec profiles
+var (
+	Compact   = NewCodec()
+	Pretty    = NewCodec(Multiline("\t"))
+	CamelCase = NewCodec(JSONNames())
+	Strict    = NewCodec(StrictUnknownFields())
+)
+
+var profiles = map[string]*Codec{
+	"compact":    Compact,
+	"pretty":     Pretty,
+	"camel_case": CamelCase,
+	"strict":     Strict,
+}
+
+// Profile returns codec by name: "compact", "pretty", "camel_case" or
+// "strict"
+func Profile(name string) (*Codec, bool) {
+	res, ok := profiles[name]
+	return res, ok
+}
+
+// Default codec is used by package-level functions
+var Default = NewCodec(Multiline("\t"))
+
+// Дефолтные кодеки. Указывают на настройки Default.
+var (
+	DefaultMarshaler   = &Default.Marshaler
+	DefaultUnmarshaler = &Default.Unmarshaler
+)
+
+// Unmarshal convenience wrapper
+func Unmarshal(r io.Reader, pb proto.Message) error {
+	return Default.Unmarshal(r, pb)
+}
+
+// Marshal convenience wrapper
+func Marshal(out io.Writer, pb proto.Message) error {
+	return Default.Marshal(out, pb)
+}
+
 // Encode object to JSON
 func Encode(src proto.Message) ([]byte, error) {
-	return DefaultMarshaler.Marshal(src)
+	return Default.Encode(src)
 }
 
 // Decode object from JSON
 func Decode(data []byte, dest proto.Message) error {
-	return DefaultUnmarshaler.Unmarshal(data, dest)
+	return Default.Decode(data, dest)
 }
@@ -0,0 +1,61 @@
+package json
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/runtime/protoimpl"
+)
+
+// GRPCCodecName is the content subtype of JSON-encoded gRPC messages, i.e.
+// "application/grpc+json"
+const GRPCCodecName = "json"
+
+// GRPCCodec implements encoding.Codec for JSON-over-gRPC
+type GRPCCodec struct {
+	Codec *Codec
+}
+
+func toProto(v interface{}) (proto.Message, error) {
+	switch x := v.(type) {
+	case proto.Message:
+		return x, nil
+	case protoiface.MessageV1:
+		return protoimpl.X.ProtoMessageV2Of(x), nil
+	}
+	return nil, fmt.Errorf("%T is not a proto.Message", v)
+}
+
+// Marshal implements encoding.Codec
+func (c GRPCCodec) Marshal(v interface{}) ([]byte, error) {
+	pb, err := toProto(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.Codec.Encode(pb)
+}
+
+// Unmarshal implements encoding.Codec
+func (c GRPCCodec) Unmarshal(data []byte, v interface{}) error {
+	pb, err := toProto(v)
+	if err != nil {
+		return err
+	}
+	return c.Codec.Decode(data, pb)
+}
+
+// Name implements encoding.Codec
+func (GRPCCodec) Name() string {
+	return GRPCCodecName
+}
+
+// init registers GRPCCodec with Compact profile for "application/grpc+json"
+// content subtype. Servers then accept both proto and JSON requests and
+// clients may select JSON with grpc.CallContentSubtype(GRPCCodecName). gRPC
+// codec registry is not safe for concurrent use, so it is filled only during
+// initialization; other codecs are set with grpc.ForceCodec.
+func init() {
+	encoding.RegisterCodec(GRPCCodec{Compact})
+}
@@ -0,0 +1,91 @@
+package json
+
+import (
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Resolver finds message and extension types for google.protobuf.Any
+// fields and extensions
+type Resolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
+// Registry resolves types registered locally, falling back to the global
+// registry. It is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	local protoregistry.Types
+}
+
+// NewRegistry creates registry with message types
+func NewRegistry(types ...protoreflect.MessageType) (*Registry, error) {
+	res := new(Registry)
+	for _, mt := range types {
+		if err := res.local.RegisterMessage(mt); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// RegisterMessage adds message type to the registry
+func (r *Registry) RegisterMessage(mt protoreflect.MessageType) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.local.RegisterMessage(mt)
+}
+
+// RegisterExtension adds extension type to the registry
+func (r *Registry) RegisterExtension(xt protoreflect.ExtensionType) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.local.RegisterExtension(xt)
+}
+
+// FindMessageByName implements protoregistry.MessageTypeResolver
+func (r *Registry) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	r.mu.RLock()
+	mt, err := r.local.FindMessageByName(name)
+	r.mu.RUnlock()
+	if err == nil {
+		return mt, nil
+	}
+	return protoregistry.GlobalTypes.FindMessageByName(name)
+}
+
+// FindMessageByURL implements protoregistry.MessageTypeResolver
+func (r *Registry) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	r.mu.RLock()
+	mt, err := r.local.FindMessageByURL(url)
+	r.mu.RUnlock()
+	if err == nil {
+		return mt, nil
+	}
+	return protoregistry.GlobalTypes.FindMessageByURL(url)
+}
+
+// FindExtensionByName implements protoregistry.ExtensionTypeResolver
+func (r *Registry) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	r.mu.RLock()
+	xt, err := r.local.FindExtensionByName(field)
+	r.mu.RUnlock()
+	if err == nil {
+		return xt, nil
+	}
+	return protoregistry.GlobalTypes.FindExtensionByName(field)
+}
+
+// FindExtensionByNumber implements protoregistry.ExtensionTypeResolver
+func (r *Registry) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	r.mu.RLock()
+	xt, err := r.local.FindExtensionByNumber(message, field)
+	r.mu.RUnlock()
+	if err == nil {
+		return xt, nil
+	}
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
@@ -0,0 +1,188 @@
+package json
+
+import (
+	"bufio"
+	"bytes"
+	stdjson "encoding/json"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Format of message sequences
+type Format int
+
+// Supported sequence formats
+const (
+	// NDJSON writes one message per line
+	NDJSON Format = iota
+	// Array writes messages as elements of JSON array
+	Array
+)
+
+// Encoder writes sequence of messages one by one, so that memory usage is
+// bounded by the size of a single message. If the underlying writer has
+// Flush method, e.g. http.ResponseWriter, it is flushed after each message.
+type Encoder struct {
+	w         io.Writer
+	marshaler func(proto.Message) ([]byte, error)
+	format    Format
+	count     int
+	closed    bool
+}
+
+// NewEncoder creates encoder of message sequence with Default codec
+func NewEncoder(w io.Writer, format Format) *Encoder {
+	return Default.NewEncoder(w, format)
+}
+
+// NewEncoder creates encoder of message sequence. Messages are always
+// written on single line, regardless of codec settings.
+func (c *Codec) NewEncoder(w io.Writer, format Format) *Encoder {
+	opts := c.Marshaler
+	opts.Multiline = false
+	opts.Indent = ""
+	return &Encoder{w: w, marshaler: opts.Marshal, format: format}
+}
+
+// Encode writes message to the stream
+func (e *Encoder) Encode(pb proto.Message) error {
+	if e.closed {
+		return fmt.Errorf("encode message: encoder is closed")
+	}
+	data, err := e.marshaler(pb)
+	if err != nil {
+		return fmt.Errorf("marshal to JSON: %w", err)
+	}
+	var prefix, suffix []byte
+	switch e.format {
+	case Array:
+		prefix = []byte(",")
+		if e.count == 0 {
+			prefix = []byte("[")
+		}
+	default:
+		suffix = []byte("\n")
+	}
+	for _, chunk := range [][]byte{prefix, data, suffix} {
+		if len(chunk) == 0 {
+			continue
+		}
+		if _, err := e.w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	e.count++
+	e.flush()
+	return nil
+}
+
+// Close finishes the stream. It does not close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	if e.format != Array {
+		return nil
+	}
+	end := "]"
+	if e.count == 0 {
+		end = "[]"
+	}
+	if _, err := io.WriteString(e.w, end); err != nil {
+		return err
+	}
+	e.flush()
+	return nil
+}
+
+func (e *Encoder) flush() {
+	if f, ok := e.w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+}
+
+// Decoder reads sequence of messages in either NDJSON or JSON array format,
+// detected by the first non-space character of the stream
+type Decoder struct {
+	r      *bufio.Reader
+	codec  *Codec
+	array  *stdjson.Decoder
+	format Format
+	init   bool
+}
+
+// NewDecoder creates decoder of message sequence with Default codec
+func NewDecoder(r io.Reader) *Decoder {
+	return Default.NewDecoder(r)
+}
+
+// NewDecoder creates decoder of message sequence
+func (c *Codec) NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), codec: c}
+}
+
+// Format returns detected format of the stream
+func (d *Decoder) Format() Format {
+	return d.format
+}
+
+func (d *Decoder) start() error {
+	d.init = true
+	for {
+		b, err := d.r.Peek(1)
+		if err != nil {
+			return err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = d.r.ReadByte()
+			continue
+		case '[':
+			d.format = Array
+			d.array = stdjson.NewDecoder(d.r)
+			_, err := d.array.Token()
+			return err
+		}
+		d.format = NDJSON
+		return nil
+	}
+}
+
+// Decode reads the next message from the stream. It returns io.EOF when
+// there are no more messages.
+func (d *Decoder) Decode(pb proto.Message) error {
+	if !d.init {
+		if err := d.start(); err != nil {
+			return err
+		}
+	}
+	if d.format == Array {
+		if !d.array.More() {
+			return io.EOF
+		}
+		var raw stdjson.RawMessage
+		if err := d.array.Decode(&raw); err != nil {
+			return fmt.Errorf("read array element: %w", err)
+		}
+		return d.decode(raw, pb)
+	}
+	for {
+		line, err := d.r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return d.decode(line, pb)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *Decoder) decode(data []byte, pb proto.Message) error {
+	if err := d.codec.Decode(data, pb); err != nil {
+		return fmt.Errorf("unmarshal JSON: %w", err)
+	}
+	return nil
+}
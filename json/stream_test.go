@@ -0,0 +1,243 @@
+package json
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func testMessages(t *testing.T, n int) []*structpb.Struct {
+	res := make([]*structpb.Struct, n)
+	for i := range res {
+		s, err := structpb.NewStruct(map[string]interface{}{
+			"id":   float64(i),
+			"name": fmt.Sprintf("item\n%d", i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[i] = s
+	}
+	return res
+}
+
+func decodeAll(dec *Decoder) ([]*structpb.Struct, error) {
+	var res []*structpb.Struct
+	for {
+		s := new(structpb.Struct)
+		err := dec.Decode(s)
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		res = append(res, s)
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	for _, format := range []Format{NDJSON, Array} {
+		for _, n := range []int{0, 1, 3} {
+			t.Run(fmt.Sprintf("%d/%d", format, n), func(t *testing.T) {
+				items := testMessages(t, n)
+				buf := new(bytes.Buffer)
+				enc := Pretty.NewEncoder(buf, format)
+				for _, item := range items {
+					if err := enc.Encode(item); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := enc.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if err := enc.Encode(new(structpb.Struct)); err == nil {
+					t.Error("encoding after Close must fail")
+				}
+				if format == NDJSON && bytes.Count(buf.Bytes(), []byte("\n")) != n {
+					t.Errorf("expected %d lines, got %q", n, buf)
+				}
+				dec := Pretty.NewDecoder(buf)
+				res, err := decodeAll(dec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n > 0 && dec.Format() != format {
+					t.Errorf("detected format %d, expected %d", dec.Format(), format)
+				}
+				if len(res) != n {
+					t.Fatalf("decoded %d messages, expected %d", len(res), n)
+				}
+				for i := range res {
+					if !proto.Equal(res[i], items[i]) {
+						t.Errorf("message %d: %v != %v", i, res[i], items[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		count int
+		fail  bool
+	}{
+		{name: "empty", input: ""},
+		{name: "spaces", input: " \n\t\r\n"},
+		{name: "empty array", input: " [ ] "},
+		{name: "ndjson without trailing newline", input: `{"a":1}` + "\n" + `{"a":2}`, count: 2},
+		{name: "ndjson with trailing newline", input: `{"a":1}` + "\n" + `{"a":2}` + "\n", count: 2},
+		{name: "ndjson with blank lines and CRLF", input: "\r\n" + `{"a":1}` + "\r\n\r\n" + `{"a":2}` + "\r\n\n", count: 2},
+		{name: "array with trailing newline", input: `[{"a":1}, {"a":2}]` + "\n", count: 2},
+		{name: "malformed ndjson line", input: `{"a":1}` + "\n" + `{"a":` + "\n", count: 1, fail: true},
+		{name: "two objects on one line", input: `{"a":1} {"a":2}`, fail: true},
+		{name: "unterminated array", input: `[{"a":1},`, count: 1, fail: true},
+		{name: "malformed array element", input: `[{"a":1},{"a"}]`, count: 1, fail: true},
+		{name: "array of non-objects", input: `[1]`, fail: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := decodeAll(NewDecoder(strings.NewReader(tc.input)))
+			if (err != nil) != tc.fail {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if len(res) != tc.count {
+				t.Errorf("decoded %d messages, expected %d", len(res), tc.count)
+			}
+		})
+	}
+}
+
+func TestEncoderEmpty(t *testing.T) {
+	for format, expected := range map[Format]string{NDJSON: "", Array: "[]"} {
+		buf := new(bytes.Buffer)
+		if err := NewEncoder(buf, format).Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expected {
+			t.Errorf("format %d: expected %q, got %q", format, expected, buf)
+		}
+	}
+}
+
+const benchItems = 1000
+
+func benchMessages(b *testing.B) []*structpb.Struct {
+	res := make([]*structpb.Struct, benchItems)
+	for i := range res {
+		s, err := structpb.NewStruct(map[string]interface{}{
+			"id":    float64(i),
+			"name":  fmt.Sprintf("item %d", i),
+			"tags":  []interface{}{"a", "b", "c"},
+			"valid": i%2 == 0,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		res[i] = s
+	}
+	return res
+}
+
+func benchList(items []*structpb.Struct) *structpb.ListValue {
+	res := &structpb.ListValue{Values: make([]*structpb.Value, len(items))}
+	for i, s := range items {
+		res.Values[i] = structpb.NewStructValue(s)
+	}
+	return res
+}
+
+func BenchmarkMarshalWhole(b *testing.B) {
+	list := benchList(benchMessages(b))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Compact.Marshal(ioutil.Discard, list); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkEncoder(b *testing.B, format Format) {
+	items := benchMessages(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		enc := Compact.NewEncoder(ioutil.Discard, format)
+		for _, item := range items {
+			if err := enc.Encode(item); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := enc.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncoderNDJSON(b *testing.B) {
+	benchmarkEncoder(b, NDJSON)
+}
+
+func BenchmarkEncoderArray(b *testing.B) {
+	benchmarkEncoder(b, Array)
+}
+
+func BenchmarkUnmarshalWhole(b *testing.B) {
+	data, err := Compact.Encode(benchList(benchMessages(b)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Compact.Unmarshal(bytes.NewReader(data), new(structpb.ListValue)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkDecoder(b *testing.B, format Format) {
+	buf := new(bytes.Buffer)
+	enc := Compact.NewEncoder(buf, format)
+	for _, item := range benchMessages(b) {
+		if err := enc.Encode(item); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dec := Compact.NewDecoder(bytes.NewReader(data))
+		for {
+			err := dec.Decode(new(structpb.Struct))
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecoderNDJSON(b *testing.B) {
+	benchmarkDecoder(b, NDJSON)
+}
+
+func BenchmarkDecoderArray(b *testing.B) {
+	benchmarkDecoder(b, Array)
+}
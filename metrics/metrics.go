@@ -0,0 +1,169 @@
+// Package metrics provides typed helpers for application metrics on top of
+// OpenCensus measures and views. Metrics are safe to declare as package-level
+// variables: their views are registered on creation and exported by whatever
+// exporter the application connects later.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Replaceable functions
+var (
+	NowFunc = time.Now
+)
+
+// Register registers views for export. Registering the same view repeatedly
+// is a no-op, so it may be called from middleware constructors directly.
+func Register(views ...*view.View) error {
+	if err := view.Register(views...); err != nil {
+		return fmt.Errorf("register views: %w", err)
+	}
+	return nil
+}
+
+// mustRegister is used by metric constructors that are typically called
+// during package initialization where there is no way to return an error
+func mustRegister(v *view.View) {
+	if err := Register(v); err != nil {
+		panic(err)
+	}
+}
+
+type tags []tag.Key
+
+func newTags(names []string) tags {
+	res := make(tags, len(names))
+	for i, name := range names {
+		res[i] = tag.MustNewKey(name)
+	}
+	return res
+}
+
+// record stores measurement with tag values assigned to the keys in order.
+// It panics if there are more values than keys: that is a programming error
+// which would otherwise silently mislabel the measurement.
+func (t tags) record(ctx context.Context, m stats.Measurement, values []string) {
+	if len(values) > len(t) {
+		panic(fmt.Sprintf("metrics: %d tag values for %d keys", len(values), len(t)))
+	}
+	mutators := make([]tag.Mutator, 0, len(values))
+	for i, v := range values {
+		mutators = append(mutators, tag.Upsert(t[i], v))
+	}
+	_ = stats.RecordWithTags(ctx, mutators, m)
+}
+
+// Counter accumulates the number of events
+type Counter struct {
+	measure *stats.Int64Measure
+	tags    tags
+	View    *view.View
+}
+
+// NewCounter creates and registers a counter with optional tag keys.
+// It panics if a different view with the same name is already registered.
+func NewCounter(name, description string, tagKeys ...string) *Counter {
+	res := &Counter{
+		measure: stats.Int64(name, description, stats.UnitDimensionless),
+		tags:    newTags(tagKeys),
+	}
+	res.View = &view.View{
+		Name:        name,
+		Description: description,
+		Measure:     res.measure,
+		TagKeys:     res.tags,
+		Aggregation: view.Sum(),
+	}
+	mustRegister(res.View)
+	return res
+}
+
+// Add n to the counter. Tag values are matched to tag keys in order;
+// extra values cause a panic.
+func (c *Counter) Add(ctx context.Context, n int64, tagValues ...string) {
+	c.tags.record(ctx, c.measure.M(n), tagValues)
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc(ctx context.Context, tagValues ...string) {
+	c.Add(ctx, 1, tagValues...)
+}
+
+// Gauge reports the last recorded value
+type Gauge struct {
+	measure *stats.Float64Measure
+	tags    tags
+	View    *view.View
+}
+
+// NewGauge creates and registers a gauge with optional tag keys.
+// It panics if a different view with the same name is already registered.
+func NewGauge(name, description string, tagKeys ...string) *Gauge {
+	res := &Gauge{
+		measure: stats.Float64(name, description, stats.UnitDimensionless),
+		tags:    newTags(tagKeys),
+	}
+	res.View = &view.View{
+		Name:        name,
+		Description: description,
+		Measure:     res.measure,
+		TagKeys:     res.tags,
+		Aggregation: view.LastValue(),
+	}
+	mustRegister(res.View)
+	return res
+}
+
+// Set the gauge value. Tag values are matched to tag keys in order;
+// extra values cause a panic.
+func (g *Gauge) Set(ctx context.Context, v float64, tagValues ...string) {
+	g.tags.record(ctx, g.measure.M(v), tagValues)
+}
+
+// Histogram aggregates values into buckets
+type Histogram struct {
+	measure *stats.Float64Measure
+	tags    tags
+	View    *view.View
+}
+
+// DefaultLatencyBuckets are suitable for request durations in milliseconds
+var DefaultLatencyBuckets = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// NewHistogram creates and registers a histogram with given bucket bounds and
+// optional tag keys. It panics if a different view with the same name is
+// already registered.
+func NewHistogram(name, description, unit string, bounds []float64, tagKeys ...string) *Histogram {
+	res := &Histogram{
+		measure: stats.Float64(name, description, unit),
+		tags:    newTags(tagKeys),
+	}
+	res.View = &view.View{
+		Name:        name,
+		Description: description,
+		Measure:     res.measure,
+		TagKeys:     res.tags,
+		Aggregation: view.Distribution(bounds...),
+	}
+	mustRegister(res.View)
+	return res
+}
+
+// Observe records the value. Tag values are matched to tag keys in order;
+// extra values cause a panic.
+func (h *Histogram) Observe(ctx context.Context, v float64, tagValues ...string) {
+	h.tags.record(ctx, h.measure.M(v), tagValues)
+}
+
+// Since records milliseconds elapsed from ts. Use it with histograms created
+// with stats.UnitMilliseconds.
+func (h *Histogram) Since(ctx context.Context, ts time.Time, tagValues ...string) {
+	h.Observe(ctx, float64(NowFunc().Sub(ts))/float64(time.Millisecond), tagValues...)
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"go.opencensus.io/stats/view"
+)
+
+func rows(t *testing.T, v *view.View) []*view.Row {
+	t.Helper()
+	res, err := view.RetrieveData(v.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func tagValue(row *view.Row, key string) string {
+	for _, tg := range row.Tags {
+		if tg.Key.Name() == key {
+			return tg.Value
+		}
+	}
+	return ""
+}
+
+func TestCounter(t *testing.T) {
+	c := NewCounter("test_counter", "test counter", "kind")
+	ctx := context.Background()
+	c.Inc(ctx, "a")
+	c.Add(ctx, 2, "a")
+	c.Inc(ctx, "b")
+	got := map[string]float64{}
+	for _, row := range rows(t, c.View) {
+		got[tagValue(row, "kind")] = row.Data.(*view.SumData).Value
+	}
+	if got["a"] != 3 || got["b"] != 1 || len(got) != 2 {
+		t.Errorf("unexpected counter data: %v", got)
+	}
+}
+
+func TestGauge(t *testing.T) {
+	g := NewGauge("test_gauge", "test gauge")
+	ctx := context.Background()
+	g.Set(ctx, 1)
+	g.Set(ctx, 42)
+	rs := rows(t, g.View)
+	if len(rs) != 1 {
+		t.Fatalf("expected one row, got %d", len(rs))
+	}
+	if v := rs[0].Data.(*view.LastValueData).Value; v != 42 {
+		t.Errorf("expected 42, got %v", v)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_histogram", "test histogram", "ms", []float64{10, 100}, "route")
+	ctx := context.Background()
+	for _, v := range []float64{1, 5, 50, 500} {
+		h.Observe(ctx, v, "/x")
+	}
+	rs := rows(t, h.View)
+	if len(rs) != 1 {
+		t.Fatalf("expected one row, got %d", len(rs))
+	}
+	if v := tagValue(rs[0], "route"); v != "/x" {
+		t.Errorf("unexpected route tag %q", v)
+	}
+	d := rs[0].Data.(*view.DistributionData)
+	if d.Count != 4 {
+		t.Errorf("expected 4 observations, got %d", d.Count)
+	}
+	want := []int64{2, 1, 1}
+	for i, n := range want {
+		if d.CountPerBucket[i] != n {
+			t.Errorf("bucket %d: expected %d, got %d", i, n, d.CountPerBucket[i])
+		}
+	}
+}
+
+func TestExtraTagValues(t *testing.T) {
+	c := NewCounter("test_counter_extra", "test counter", "kind")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on extra tag values")
+		}
+	}()
+	c.Inc(context.Background(), "a", "b")
+}
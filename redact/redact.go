@@ -0,0 +1,212 @@
+// Package redact hides sensitive data from debug logs of requests and
+// responses
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Placeholder replaces redacted values
+var Placeholder = "[REDACTED]"
+
+// Rules specify what to hide from logs and how much to log. Loading rules
+// from the environment overrides only the variables that are set.
+type Rules struct {
+	Headers []string `envconfig:"LOG_REDACT_HEADERS"`
+	Fields  []string `envconfig:"LOG_REDACT_FIELDS"`
+	MaxSize int      `envconfig:"LOG_BODY_LIMIT"`
+}
+
+// Default rules are used by debug middleware unless specified explicitly.
+// Application loads them from the environment on start.
+var Default = Rules{
+	Headers: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+	Fields:  []string{"password", "secret", "token", "access_token", "refresh_token"},
+	MaxSize: 4096,
+}
+
+// debugRedactField is the number of `debug_redact` in google.protobuf.FieldOptions
+const debugRedactField = 16
+
+// Header returns copy of the header with configured values replaced
+func (r Rules) Header(src http.Header) http.Header {
+	res := src.Clone()
+	for _, k := range r.Headers {
+		if _, ok := res[http.CanonicalHeaderKey(k)]; ok {
+			res.Set(k, Placeholder)
+		}
+	}
+	return res
+}
+
+func (r Rules) field(name string) bool {
+	for _, f := range r.Fields {
+		if strings.EqualFold(f, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON replaces values of configured fields at any depth of JSON document.
+// Data that is not a valid JSON is returned as is.
+func (r Rules) JSON(data []byte) []byte {
+	if len(r.Fields) == 0 {
+		return data
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return data
+	}
+	res, err := json.Marshal(r.value(doc))
+	if err != nil {
+		return data
+	}
+	return res
+}
+
+func (r Rules) value(src interface{}) interface{} {
+	switch x := src.(type) {
+	case map[string]interface{}:
+		for k, v := range x {
+			if r.field(k) {
+				x[k] = Placeholder
+			} else {
+				x[k] = r.value(v)
+			}
+		}
+	case []interface{}:
+		for i, v := range x {
+			x[i] = r.value(v)
+		}
+	}
+	return src
+}
+
+// Form replaces values of configured fields in URL-encoded form data
+func (r Rules) Form(data []byte) []byte {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return data
+	}
+	for k := range values {
+		if r.field(k) {
+			values[k] = []string{Placeholder}
+		}
+	}
+	return []byte(values.Encode())
+}
+
+// Body redacts request or response body according to its content type
+func (r Rules) Body(data []byte, contentType string) []byte {
+	switch {
+	case strings.Contains(contentType, "json"):
+		return r.JSON(data)
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		return r.Form(data)
+	}
+	return data
+}
+
+// Truncate cuts data to MaxSize bytes
+func (r Rules) Truncate(data []byte) []byte {
+	if r.MaxSize > 0 && len(data) > r.MaxSize {
+		return append(data[:r.MaxSize:r.MaxSize], "..."...)
+	}
+	return data
+}
+
+// Proto returns copy of the message with sensitive fields redacted. Fields
+// are considered sensitive if marked with `debug_redact` option or with a
+// boolean extension option named `sensitive`. String fields are replaced with
+// Placeholder, others are cleared.
+func Proto(src proto.Message) proto.Message {
+	if src == nil {
+		return nil
+	}
+	res := proto.Clone(src)
+	message(res.ProtoReflect())
+	return res
+}
+
+func message(m protoreflect.Message) {
+	var sensitive []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case Sensitive(fd):
+			sensitive = append(sensitive, fd)
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+					message(mv.Message())
+					return true
+				})
+			}
+		case fd.IsList():
+			if fd.Message() != nil {
+				list := v.List()
+				for i := 0; i < list.Len(); i++ {
+					message(list.Get(i).Message())
+				}
+			}
+		case fd.Message() != nil:
+			message(v.Message())
+		}
+		return true
+	})
+	for _, fd := range sensitive {
+		if fd.Kind() == protoreflect.StringKind && fd.Cardinality() != protoreflect.Repeated {
+			m.Set(fd, protoreflect.ValueOfString(Placeholder))
+			continue
+		}
+		m.Clear(fd)
+	}
+}
+
+// Sensitive reports whether the field is marked with `debug_redact` or
+// `sensitive` option
+func Sensitive(fd protoreflect.FieldDescriptor) bool {
+	opts, ok := fd.Options().(*descriptorpb.FieldOptions)
+	if !ok || opts == nil {
+		return false
+	}
+	var res bool
+	opts.ProtoReflect().Range(func(f protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if f.Kind() == protoreflect.BoolKind && (f.Name() == "sensitive" || f.Name() == "debug_redact") {
+			res = v.Bool()
+		}
+		return !res
+	})
+	if res {
+		return true
+	}
+	// older descriptor.proto versions keep debug_redact among unknown fields
+	for b := opts.ProtoReflect().GetUnknown(); len(b) > 0; {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return false
+		}
+		b = b[n:]
+		if num == debugRedactField && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			return n > 0 && v != 0
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return false
+		}
+		b = b[n:]
+	}
+	return false
+}
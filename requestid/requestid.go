@@ -0,0 +1,69 @@
+// Package requestid keeps request ID in context metadata, so it is logged
+// by HTTP and gRPC middleware and passed to outbound calls made with
+// go-mixins/metadata transports and interceptors.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/go-mixins/metadata"
+)
+
+// Header carries request ID in HTTP requests, responses and gRPC metadata
+const Header = "X-Request-Id"
+
+// MetadataKey is the context metadata entry holding request ID
+const MetadataKey = "Request-Id"
+
+// MaxLength limits accepted request IDs
+const MaxLength = 128
+
+// Replaceable functions
+var (
+	NewFunc = newID
+)
+
+// newID returns random UUID version 4
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Valid reports whether request ID received from the client may be accepted.
+// Only printable ASCII IDs not longer than MaxLength are valid.
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Ensure returns the first valid candidate or a new request ID
+func Ensure(candidates ...string) string {
+	for _, id := range candidates {
+		if Valid(id) {
+			return id
+		}
+	}
+	return NewFunc()
+}
+
+// With stores request ID in context metadata
+func With(ctx context.Context, id string) context.Context {
+	return metadata.Set(ctx, MetadataKey, id)
+}
+
+// From returns request ID stored in context metadata
+func From(ctx context.Context) string {
+	return metadata.Get(ctx, MetadataKey)
+}
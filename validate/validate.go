@@ -0,0 +1,114 @@
+// Package validate runs request validation and converts failures to
+// InvalidArgument errors with BadRequest field violations.
+//
+// Messages are validated with their ValidateAll() or Validate() methods as
+// generated by protoc-gen-validate. Other validators, e.g. protovalidate, may
+// be plugged in with Register.
+package validate
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-mixins/microservice/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// Func validates message. It returns nil for valid messages and for types
+// it does not know how to validate.
+type Func func(msg interface{}) error
+
+var validators = struct {
+	sync.RWMutex
+	list []Func
+}{
+	list: []Func{Method},
+}
+
+// Register adds validator to be run by Check
+func Register(f Func) {
+	validators.Lock()
+	defer validators.Unlock()
+	validators.list = append(validators.list, f)
+}
+
+// Method validates message with its ValidateAll or Validate method
+func Method(msg interface{}) error {
+	switch v := msg.(type) {
+	case interface{ ValidateAll() error }:
+		return v.ValidateAll()
+	case interface{ Validate() error }:
+		return v.Validate()
+	}
+	return nil
+}
+
+// Message is the client-facing message of validation errors
+var Message = "invalid request"
+
+// Check runs registered validators and returns InvalidArgument error with
+// field violations if the message is invalid. Errors that already have gRPC
+// status are returned as is.
+func Check(msg interface{}) error {
+	validators.RLock()
+	defer validators.RUnlock()
+	for _, f := range validators.list {
+		err := f(msg)
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
+			return err
+		}
+		return errors.InvalidArgument(Message, Violations(err)...).Wrap(err)
+	}
+	return nil
+}
+
+// fieldError is implemented by protoc-gen-validate errors
+type fieldError interface {
+	Field() string
+	Reason() string
+}
+
+// Violations converts validation error to field violations. Multiple
+// errors are expanded with AllErrors() method, nested field errors are
+// flattened to dotted paths.
+func Violations(err error) []*errdetails.BadRequest_FieldViolation {
+	if multi, ok := err.(interface{ AllErrors() []error }); ok {
+		var res []*errdetails.BadRequest_FieldViolation
+		for _, e := range multi.AllErrors() {
+			res = append(res, Violations(e)...)
+		}
+		return res
+	}
+	if fe, ok := err.(fieldError); ok {
+		return fieldViolations("", fe)
+	}
+	return []*errdetails.BadRequest_FieldViolation{errors.Field("", err.Error())}
+}
+
+func fieldViolations(prefix string, fe fieldError) []*errdetails.BadRequest_FieldViolation {
+	path := fe.Field()
+	if prefix != "" {
+		path = fmt.Sprintf("%s.%s", prefix, path)
+	}
+	if c, ok := fe.(interface{ Cause() error }); ok && c.Cause() != nil {
+		switch cause := c.Cause().(type) {
+		case interface{ AllErrors() []error }:
+			var res []*errdetails.BadRequest_FieldViolation
+			for _, e := range cause.AllErrors() {
+				if nested, ok := e.(fieldError); ok {
+					res = append(res, fieldViolations(path, nested)...)
+				}
+			}
+			if len(res) > 0 {
+				return res
+			}
+		case fieldError:
+			return fieldViolations(path, cause)
+		}
+	}
+	return []*errdetails.BadRequest_FieldViolation{errors.Field(path, fe.Reason())}
+}